@@ -0,0 +1,46 @@
+package lisgo
+
+import "time"
+
+//backend is an implementation of the scanning API. It mirrors struct lis_api of libinsane.
+type backend interface {
+	//listDevices returns descriptors of available scanners, locations is enum lis_device_locations
+	listDevices(locations uint32) ([]*Scanner, error)
+	//getDevice opens the root item of the device
+	getDevice(deviceID string) (backendItem, error)
+	//cleanup releases the backend
+	cleanup()
+	//setTimeouts applies the limits enforced by the backend itself (warm-up, watchdog)
+	setTimeouts(t Timeouts)
+	//currentCall returns the name of the running C proxy and for how long it's been running, if any
+	currentCall() (string, time.Duration)
+}
+
+//backendItem mirrors struct lis_item: a device or one of its paper sources
+type backendItem interface {
+	name() string
+	kind() ItemType
+	children() ([]backendItem, error)
+	options() ([]*OptionDescriptor, error)
+	scanStart() (backendSession, error)
+	close()
+}
+
+//backendOption mirrors the functions of struct lis_option_descriptor
+type backendOption interface {
+	getValue() (*LisValue, error)
+	//setValue passes the value to the driver as is, it must have the type of the option.
+	//It returns LIS_SET_FLAG_* bits reported by the driver.
+	setValue(v *LisValue) (int, error)
+}
+
+//backendSession mirrors struct lis_scan_session
+type backendSession interface {
+	endOfFeed() bool
+	endOfPage() bool
+	scanParameters() (*ScanParameters, error)
+	//scanRead returns the next chunk of the page, at most size bytes. The chunk is valid until the next call.
+	scanRead(size int) ([]byte, error)
+	cancel()
+	close()
+}
@@ -0,0 +1,473 @@
+//go:build cgo && !lisgo_fake
+// +build cgo,!lisgo_fake
+
+package lisgo
+
+// LDFLAGS: --static ${SRCDIR}/../libinsane.a -lregex -lole32  -loleaut32 -luuid -lsystre -ltre  -lpthread -lintl -liconv
+
+/*
+#include <libinsane/capi.h>
+#include <lislib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/apex/log"
+	"github.com/mattn/go-pointer"
+)
+
+const defaultBackend = BackendLibinsane
+
+type (
+	//lisBackend is a holder for *lis_api. All libinsane calls go thru its executor.
+	lisBackend struct {
+		lisgo *C.struct_lis_api
+		exec  *executor
+
+		mu       sync.Mutex
+		timeouts Timeouts
+		//stopWatchdog stops the running watchdog, if any
+		stopWatchdog chan struct{}
+	}
+
+	//lisItem wraps *lis_item, either a device or a paper source
+	lisItem struct {
+		lis      *lisBackend
+		item     *C.struct_lis_item
+		itemName string
+		itemKind ItemType
+	}
+
+	//lisOption wraps *lis_option_descriptor
+	lisOption struct {
+		lis       *lisBackend
+		optStruct *C.struct_lis_option_descriptor
+		valType   C.enum_lis_value_type
+	}
+
+	//lisSession wraps *lis_scan_session and the C buffer scan_read writes into
+	lisSession struct {
+		lis            *lisBackend
+		lisScanSession *C.struct_lis_scan_session
+		cBuffer        unsafe.Pointer
+		cBufferSize    int
+	}
+
+	iterSourcesCallback struct {
+		callback func(*lisItem) bool
+	}
+
+	iterOptionsCallback struct {
+		callback func(*OptionDescriptor) bool
+	}
+)
+
+//newLisBackend creates new instance of lis_api using lis_safe_bet on a dedicated OS thread
+func newLisBackend() (*lisBackend, error) {
+	lib := lisBackend{exec: newExecutor()}
+	err := lib.exec.do("lis_api_get_api", func() error {
+		C.set_log_callbacks()
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+
+		lib.lisgo = C.lis_api_get_api(errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	if err != nil {
+		lib.exec.stop()
+		return nil, err
+	}
+	return &lib, nil
+}
+
+func (o *lisBackend) cleanup() {
+	o.setTimeouts(Timeouts{})
+	_ = o.exec.do("lis_api_cleanup_proxy", func() error {
+		C.lis_api_cleanup_proxy(o.lisgo)
+		return nil
+	})
+	o.exec.stop()
+}
+
+func (o *lisBackend) setTimeouts(t Timeouts) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.timeouts = t
+	if o.stopWatchdog != nil {
+		close(o.stopWatchdog)
+		o.stopWatchdog = nil
+	}
+	if t.Watchdog > 0 {
+		o.stopWatchdog = make(chan struct{})
+		go o.exec.watch(t.Watchdog, t.OnStall, o.stopWatchdog)
+	}
+}
+
+func (o *lisBackend) getTimeouts() Timeouts {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.timeouts
+}
+
+func (o *lisBackend) currentCall() (string, time.Duration) {
+	return o.exec.currentCall()
+}
+
+func (o *lisBackend) listDevices(locations uint32) ([]*Scanner, error) {
+	var devices []*Scanner
+	err := o.exec.do("lis_api_list_devices_proxy", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+
+		cdevs := C.lis_api_list_devices_proxy(o.lisgo, C.enum_lis_device_locations(locations), errProxy.GetProxy())
+		if err := errProxy.Err(); err != nil || cdevs == nil {
+			return err
+		}
+
+		arrLen := C.lis_array_length(unsafe.Pointer(cdevs))
+
+		//Apply strong magic to get GO slice backed by C null-terminated array
+		devs := (*[maxSliceLen]*C.struct_lis_device_descriptor)(unsafe.Pointer(cdevs))[:arrLen:arrLen]
+
+		devices = make([]*Scanner, 0)
+		for _, d := range devs {
+			devices = append(devices, conv2Go(d))
+		}
+		return nil
+	})
+	return devices, err
+}
+
+func conv2Go(d *C.struct_lis_device_descriptor) *Scanner {
+	return &Scanner{
+		DeviceID: C.GoString(d.dev_id),
+		Vendor:   C.GoString(d.vendor),
+		Model:    C.GoString(d.model),
+		Type:     C.GoString(d._type),
+	}
+}
+
+func (o *lisBackend) getDevice(deviceID string) (backendItem, error) {
+	var item *C.struct_lis_item
+	err := o.exec.do("lis_api_get_device_proxy", func() error {
+		var dev *C.char = C.CString(deviceID)
+		defer C.free(unsafe.Pointer(dev))
+
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+
+		item = C.lis_api_get_device_proxy(o.lisgo, dev, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lisItem{lis: o, item: item, itemName: deviceID, itemKind: LisItemDevice}, nil
+}
+
+func (i *lisItem) name() string {
+	return i.itemName
+}
+
+func (i *lisItem) kind() ItemType {
+	return i.itemKind
+}
+
+func (i *lisItem) close() {
+	_ = i.lis.exec.do("lis_item_close_proxy", func() error {
+		C.lis_item_close_proxy(i.item)
+		return nil
+	})
+}
+
+func (i *lisItem) children() ([]backendItem, error) {
+	var res []backendItem
+	proxy := iterSourcesCallback{func(c *lisItem) bool {
+		c.lis = i.lis
+		res = append(res, c)
+		return true
+	}}
+	cb := pointer.Save(&proxy)
+	defer pointer.Unref(cb)
+
+	err := i.lis.exec.do("lis_item_iterate_sources", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+
+		C.lis_item_iterate_sources(i.lis.lisgo, nil, i.item, cb, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (i *lisItem) options() ([]*OptionDescriptor, error) {
+	var res []*OptionDescriptor
+	proxy := iterOptionsCallback{func(o *OptionDescriptor) bool {
+		o.opt.(*lisOption).lis = i.lis
+		res = append(res, o)
+		return true
+	}}
+	cb := pointer.Save(&proxy)
+	defer pointer.Unref(cb)
+
+	err := i.lis.exec.do("lis_item_iterate_options", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+
+		C.lis_item_iterate_options(i.item, cb, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (i *lisItem) scanStart() (backendSession, error) {
+	var session *C.struct_lis_scan_session
+	err := i.lis.exec.do("lis_item_scan_start_proxy", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+		session = C.lis_item_scan_start_proxy(i.item, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//the buffer is allocated by the first scanRead, its size is known there
+	return &lisSession{
+		lis:            i.lis,
+		lisScanSession: session,
+	}, nil
+}
+
+//export iterSourcesProxy
+func iterSourcesProxy(cb unsafe.Pointer, sourcePtr *C.struct_lis_item, sourceName *C.char, kind C.enum_lis_item_type) C.int {
+	res := &lisItem{
+		item:     sourcePtr,
+		itemName: C.GoString(sourceName),
+		itemKind: ItemType(kind),
+	}
+	if pointer.Restore(cb).(*iterSourcesCallback).callback(res) {
+		return 1
+	}
+	return 0
+}
+
+//export iterOptionsProxy
+func iterOptionsProxy(cb unsafe.Pointer, opt *C.struct_lis_option_descriptor, valType C.enum_lis_value_type, conType C.int, conPossible unsafe.Pointer) C.int {
+	res := &OptionDescriptor{
+		Name:         C.GoString(opt.name),
+		Title:        C.GoString(opt.title),
+		Desc:         C.GoString(opt.desc),
+		Capabilities: int(opt.capabilities),
+		ValueType:    ValueType(valType),
+		ValueUnit:    Unit(opt.value.unit),
+		Constraint:   NewConstraint(valType, conType, conPossible),
+		opt:          &lisOption{optStruct: opt, valType: valType},
+	}
+
+	if pointer.Restore(cb).(*iterOptionsCallback).callback(res) {
+		return 1
+	}
+	return 0
+}
+
+func (o *lisOption) getValue() (*LisValue, error) {
+	var res *LisValue
+	err := o.lis.exec.do("lis_option_descriptor_get_value_proxy", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+		val := C.lis_option_descriptor_get_value_proxy(o.optStruct, errProxy.GetProxy())
+		if err := errProxy.Err(); err != nil {
+			return err
+		}
+		res = NewValue(val, o.valType)
+		return nil
+	})
+	return res, err
+}
+
+func (o *lisOption) setValue(v *LisValue) (int, error) {
+	var flags C.int
+	err := o.lis.exec.do("lis_option_descriptor_set_value_proxy", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+
+		var intVal C.int
+		var strVal *C.char
+		switch v.ValType {
+		case LisTypeBool:
+			if v.BoolValue {
+				intVal = 1
+			}
+		case LisTypeInteger:
+			intVal = C.int(v.IntValue)
+		case LisTypeImageFormat:
+			intVal = C.int(v.ImgFormat)
+		case LisTypeString:
+			strVal = C.CString(v.StringValue)
+			defer C.free(unsafe.Pointer(strVal))
+		}
+		C.lis_option_descriptor_set_value_proxy(o.optStruct, intVal, C.double(v.DoubleValue), strVal, &flags, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	return int(flags), err
+}
+
+//endOfFeed reports the end if the API is closed, there is nothing more to read then
+func (s *lisSession) endOfFeed() bool {
+	var res bool
+	err := s.lis.exec.do("lis_scan_session_end_of_feed_proxy", func() error {
+		res = C.lis_scan_session_end_of_feed_proxy(s.lisScanSession) != 0
+		return nil
+	})
+	return res || err != nil
+}
+
+func (s *lisSession) endOfPage() bool {
+	var res bool
+	err := s.lis.exec.do("lis_scan_session_end_of_page_proxy", func() error {
+		res = C.lis_scan_session_end_of_page_proxy(s.lisScanSession) != 0
+		return nil
+	})
+	return res || err != nil
+}
+
+func (s *lisSession) scanRead(size int) ([]byte, error) {
+	if size <= 0 || size > maxSliceLen {
+		//the buffer is sliced as an array of maxSliceLen bytes below
+		return nil, newError(LisErrInvalidValue, "scanRead", fmt.Sprintf("buffer size %d", size))
+	}
+	if size != s.cBufferSize {
+		C.free(s.cBuffer)
+		s.cBuffer = C.calloc(C.size_t(size), C.sizeof_char)
+		if s.cBuffer == nil {
+			s.cBufferSize = 0
+			return nil, newError(LisErrNoMem, "scanRead", fmt.Sprintf("cannot allocate %d bytes", size))
+		}
+		s.cBufferSize = size
+	}
+	var arrlen = C.size_t(size)
+	warmUp := s.lis.getTimeouts().WarmUp
+	//the C proxy waits for the lamp in 1 sec steps
+	warmUpSec := C.int((warmUp + time.Second - 1) / time.Second)
+	err := s.lis.exec.do("lis_scan_session_scan_read_proxy", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+		C.lis_scan_session_scan_read_proxy(s.lisScanSession, s.cBuffer, &arrlen, warmUpSec, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	if lisErr, ok := err.(*Error); ok && lisErr.Code == LisWarmingUp {
+		return nil, &TimeoutError{Op: "WarmUp", Func: lisErr.Func, Limit: warmUp}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//Very very strong magic here
+	return (*[maxSliceLen]byte)(s.cBuffer)[:arrlen:arrlen], nil
+}
+
+//cancel bypasses the executor: it's meant to interrupt scan_read which keeps the executor busy
+func (s *lisSession) cancel() {
+	C.lis_scan_session_cancel_proxy(s.lisScanSession)
+}
+
+func (s *lisSession) scanParameters() (*ScanParameters, error) {
+	var params C.struct_lis_scan_parameters
+	err := s.lis.exec.do("lis_scan_session_get_scan_parameters_proxy", func() error {
+		errProxy := getErrorProxy()
+		defer releaseErrorProxy(errProxy)
+		C.lis_scan_session_get_scan_parameters_proxy(s.lisScanSession, &params, errProxy.GetProxy())
+		return errProxy.Err()
+	})
+	return &ScanParameters{
+		format:    ImageFormat(params.format),
+		width:     int(params.width),
+		height:    int(params.height),
+		imageSize: uint(params.image_size),
+	}, err
+}
+
+func (s *lisSession) close() {
+	C.free(s.cBuffer)
+	s.cBuffer = nil
+	s.cBufferSize = 0
+}
+
+//NewValue constructs GO LisValue struct from lis_value C-struct
+func NewValue(val *C.union_lis_value, typ C.enum_lis_value_type) *LisValue {
+	var res LisValue
+	res.ValType = ValueType(typ)
+	switch res.ValType {
+	case LisTypeBool:
+		res.BoolValue = *((*C.int)(unsafe.Pointer(val))) != 0
+	case LisTypeInteger:
+		res.IntValue = int(*((*C.int)(unsafe.Pointer(val))))
+	case LisTypeDouble:
+		res.DoubleValue = *((*float64)(unsafe.Pointer(val)))
+	case LisTypeString:
+		res.StringValue = C.GoString(*(**C.char)(unsafe.Pointer(val)))
+	case LisTypeImageFormat:
+		res.ImgFormat = ImageFormat(*(*C.enum_lis_img_format)(unsafe.Pointer(val)))
+	default:
+		panic("Unknown value type")
+	}
+	return &res
+}
+
+//NewConstraint costructs Go ValueConstraint struct from C-structs
+func NewConstraint(valType C.enum_lis_value_type, conType C.int, conPossible unsafe.Pointer) *OptionConstraint {
+	con := OptionConstraint{
+		ConstraintType: int(conType),
+	}
+
+	if con.ConstraintType == LisConstraintList {
+		conList := (*C.struct_lis_value_list)(conPossible)
+		con.PossibleList = []*LisValue{}
+
+		slice := carrToSlice(conList.values, int(conList.nb_values))
+		for i := range slice {
+			c := NewValue(&slice[i], valType)
+			con.PossibleList = append(con.PossibleList, c)
+		}
+	}
+
+	if con.ConstraintType == LisConstraintRange {
+		conRange := (*C.struct_lis_value_range)(conPossible)
+
+		var c ValueRange
+		c.MinValue = NewValue(&conRange.min, valType)
+		c.MaxValue = NewValue(&conRange.max, valType)
+		c.Interval = NewValue(&conRange.interval, valType)
+		con.PossibleRange = &c
+	}
+	return &con
+}
+
+func carrToSlice(arr *C.union_lis_value, count int) []C.union_lis_value {
+
+	//Apply strong magic to get GO slice backed by C null-terminated array
+	slice := (*[maxSliceLen]C.union_lis_value)(unsafe.Pointer(arr))[:count:count]
+	return slice
+}
+
+//export logProxy
+func logProxy(lvl C.enum_lis_log_level, msg *C.char) {
+	if uint32(lvl) >= logLevel {
+		if uint32(lvl) >= LisLogLvlError {
+			log.WithField("error", C.GoString(msg)).Error("libinsane error")
+		} else {
+			log.WithField("message", C.GoString(msg)).Debug("libinsane log message")
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !cgo || lisgo_fake
+// +build !cgo lisgo_fake
+
+package lisgo
+
+import "errors"
+
+const defaultBackend = BackendFake
+
+//newLisBackend is a stub for builds without libinsane
+func newLisBackend() (backend, error) {
+	return nil, errors.New("lisgo is built without libinsane support")
+}
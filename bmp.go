@@ -1,6 +1,5 @@
 package lisgo
 
-import "C"
 import (
 	"bytes"
 	"encoding/binary"
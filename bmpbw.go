@@ -6,6 +6,9 @@ import (
 	"image/color"
 )
 
+//bmpBwShift is the magic shift of 1-bit images in pixels, see ImageBmpBw.ColorIndexAt
+const bmpBwShift = 64
+
 //ImageBmpBw represents a black-N-white image with 1 bit per pixel
 type ImageBmpBw struct {
 	data     []byte
@@ -42,7 +45,7 @@ func (i *ImageBmpBw) Bounds() image.Rectangle {
 //ColorIndexAt returns the color index of the pixel at (x, y).
 func (i *ImageBmpBw) ColorIndexAt(x, y int) uint8 {
 	//magic 64 pixels shift of image
-	x = x + 64
+	x = x + bmpBwShift
 	if x >= int(i.header.Width) {
 		x = x - int(i.header.Width)
 	}
@@ -0,0 +1,200 @@
+package lisgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type (
+	//Capabilities summarizes what the scanner can do, per paper source
+	Capabilities struct {
+		DeviceID string               `json:"device_id"`
+		Sources  []SourceCapabilities `json:"sources"`
+	}
+
+	//SourceCapabilities is derived from the options of the paper source and their constraints.
+	//Fields are empty if the source has no such option or the option has no constraint.
+	SourceCapabilities struct {
+		Name string   `json:"name"`
+		Kind ItemType `json:"kind"`
+		//Modes are the canonical values of the mode option
+		Modes []ColorMode `json:"modes,omitempty"`
+		//Resolutions are the allowed resolutions if the option has a list constraint
+		Resolutions []int `json:"resolutions,omitempty"`
+		//ResolutionRange is set if the option has a range constraint
+		ResolutionRange *ResolutionRange `json:"resolution_range,omitempty"`
+		//MaxWidth and MaxHeight are the largest scan area in millimeters
+		MaxWidth  float64 `json:"max_width_mm,omitempty"`
+		MaxHeight float64 `json:"max_height_mm,omitempty"`
+		Duplex    bool    `json:"duplex"`
+		//Formats are the values of image format options
+		Formats []ImageFormat `json:"formats,omitempty"`
+	}
+
+	//ResolutionRange is the range of the resolution option in DPI, Step is 0 if any value is allowed
+	ResolutionRange struct {
+		Min  int `json:"min"`
+		Max  int `json:"max"`
+		Step int `json:"step,omitempty"`
+	}
+)
+
+//Capabilities returns the summary of all paper sources. The device is open temporarily if it's not open.
+func (d *Scanner) Capabilities() (*Capabilities, error) {
+	caps := Capabilities{DeviceID: d.DeviceID}
+	var serr error
+	err := d.IterateSources(func(s *PaperSource) bool {
+		var sc *SourceCapabilities
+		if sc, serr = s.Capabilities(); serr != nil {
+			return false
+		}
+		caps.Sources = append(caps.Sources, *sc)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if serr != nil {
+		return nil, serr
+	}
+	return &caps, nil
+}
+
+//Capabilities returns the summary of the paper source
+func (s *PaperSource) Capabilities() (*SourceCapabilities, error) {
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	caps := SourceCapabilities{Name: s.Name, Kind: s.Kind}
+	for _, o := range opts {
+		switch {
+		case o.ValueType == LisTypeImageFormat:
+			for _, v := range constraintList(o) {
+				caps.Formats = append(caps.Formats, v.ImgFormat)
+			}
+		case o.Name == OptionResolution:
+			caps.Resolutions, caps.ResolutionRange = resolutions(o)
+		case o.CanonicalName() == OptionMode:
+			for _, v := range constraintList(o) {
+				caps.Modes = append(caps.Modes, ColorMode(o.CanonicalValue(*v).StringValue))
+			}
+		case o.CanonicalName() == OptionDuplex:
+			caps.Duplex = caps.Duplex || o.IsWritable()
+		case o.Name == OptionSource:
+			//SANE drivers select duplex with the source option, e.g. "ADF Duplex"
+			for _, v := range constraintList(o) {
+				if strings.Contains(strings.ToLower(v.StringValue), "duplex") {
+					caps.Duplex = true
+				}
+			}
+		}
+	}
+	if caps.MaxWidth, caps.MaxHeight, err = s.maxArea(); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+//maxArea returns the size of the largest scan area in mm, zeros if the area options have no ranges
+func (s *PaperSource) maxArea() (float64, float64, error) {
+	var limits [4]float64
+	for k, name := range []string{OptionTLX, OptionTLY, OptionBRX, OptionBRY} {
+		if opt, err := s.Option(name); err != nil || opt == nil {
+			return 0, 0, err
+		}
+		min, max, err := s.areaLimits(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		limits[k] = min
+		if k >= 2 {
+			limits[k] = max
+		}
+	}
+	width, height := limits[2]-limits[0], limits[3]-limits[1]
+	if math.IsInf(width, 0) || math.IsInf(height, 0) {
+		return 0, 0, nil
+	}
+	return width, height, nil
+}
+
+//constraintList returns the values of the option's list constraint
+func constraintList(o *OptionDescriptor) ValueList {
+	if o.Constraint == nil || o.Constraint.ConstraintType != LisConstraintList {
+		return nil
+	}
+	return o.Constraint.PossibleList
+}
+
+//resolutions returns either the list or the range of the resolution option
+func resolutions(o *OptionDescriptor) ([]int, *ResolutionRange) {
+	if o.Constraint == nil {
+		return nil, nil
+	}
+	toInt := func(v *LisValue) int {
+		if v == nil {
+			return 0
+		}
+		f, _ := v.number()
+		return int(math.Round(f))
+	}
+	switch o.Constraint.ConstraintType {
+	case LisConstraintList:
+		var res []int
+		for _, v := range o.Constraint.PossibleList {
+			res = append(res, toInt(v))
+		}
+		return res, nil
+	case LisConstraintRange:
+		if r := o.Constraint.PossibleRange; r != nil {
+			return nil, &ResolutionRange{Min: toInt(r.MinValue), Max: toInt(r.MaxValue), Step: toInt(r.Interval)}
+		}
+	}
+	return nil, nil
+}
+
+//MarshalText writes the kind by name
+func (t ItemType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+//UnmarshalText accepts the name of the kind
+func (t *ItemType) UnmarshalText(text []byte) error {
+	for k, v := range lisItemTypeNames {
+		if v == string(text) {
+			*t = k
+			return nil
+		}
+	}
+	//String of an unknown kind
+	var n uint32
+	if _, err := fmt.Sscanf(string(text), "ItemType(%d)", &n); err == nil {
+		*t = ItemType(n)
+		return nil
+	}
+	return fmt.Errorf("unknown item type '%s'", text)
+}
+
+//MarshalText writes the format by name
+func (f ImageFormat) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+//UnmarshalText accepts the name of the format
+func (f *ImageFormat) UnmarshalText(text []byte) error {
+	for k, v := range lisImageFormatNames {
+		if v == string(text) {
+			*f = k
+			return nil
+		}
+	}
+	//String of an unknown format
+	var n uint32
+	if _, err := fmt.Sscanf(string(text), "ImageFormat(%d)", &n); err == nil {
+		*f = ImageFormat(n)
+		return nil
+	}
+	return fmt.Errorf("unknown image format '%s'", text)
+}
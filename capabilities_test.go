@@ -0,0 +1,130 @@
+package lisgo
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+//testCapabilitiesConfig is the default virtual scanner with a resolution range, formats and a duplex feeder
+func testCapabilitiesConfig() *FakeConfig {
+	cfg := DefaultFakeConfig()
+	var opts []*FakeOption
+	for _, o := range DefaultFakeOptions() {
+		if o.Name != OptionResolution {
+			opts = append(opts, o)
+		}
+	}
+	cfg.Devices[0].Sources[1].Options = append(opts,
+		&FakeOption{
+			Name: OptionResolution, Title: "Resolution", Capabilities: LisCapSwSelect, ValueType: LisTypeInteger, ValueUnit: LisUnitDPI,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintRange,
+				PossibleRange: &ValueRange{
+					MinValue: &LisValue{ValType: LisTypeInteger, IntValue: 100},
+					MaxValue: &LisValue{ValType: LisTypeInteger, IntValue: 1200},
+					Interval: &LisValue{ValType: LisTypeInteger, IntValue: 50},
+				},
+			},
+			Value: &LisValue{ValType: LisTypeInteger, IntValue: 300},
+		},
+		&FakeOption{
+			Name: "duplex_enabled", Title: "Duplex", Capabilities: LisCapSwSelect, ValueType: LisTypeBool,
+			Value: &LisValue{ValType: LisTypeBool},
+		},
+		&FakeOption{
+			Name: "format", Title: "Format", Capabilities: LisCapSwSelect, ValueType: LisTypeImageFormat,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintList,
+				PossibleList: ValueList{
+					{ValType: LisTypeImageFormat, ImgFormat: LisImgFormatBmp},
+					{ValType: LisTypeImageFormat, ImgFormat: LisImgFormatJpeg},
+				},
+			},
+			Value: &LisValue{ValType: LisTypeImageFormat, ImgFormat: LisImgFormatBmp},
+		},
+	)
+	return cfg
+}
+
+func TestCapabilities(t *testing.T) {
+	modes := []ColorMode{ColorModeBW, ColorModeGray, ColorModeColor}
+	flatbed := SourceCapabilities{
+		Name: "flatbed", Kind: LisItemFlatbed, Modes: modes,
+		Resolutions: []int{75, 150, 300, 600},
+		MaxWidth:    215.9, MaxHeight: 297,
+	}
+	tests := []struct {
+		name string
+		cfg  *FakeConfig
+		want []SourceCapabilities
+	}{
+		{"default", nil, []SourceCapabilities{
+			flatbed,
+			{
+				Name: "feeder", Kind: LisItemAdf, Modes: modes,
+				Resolutions: []int{75, 150, 300, 600},
+				MaxWidth:    215.9, MaxHeight: 297,
+			},
+		}},
+		{"range and duplex", testCapabilitiesConfig(), []SourceCapabilities{
+			flatbed,
+			{
+				Name: "feeder", Kind: LisItemAdf, Modes: modes,
+				ResolutionRange: &ResolutionRange{Min: 100, Max: 1200, Step: 50},
+				MaxWidth:        215.9, MaxHeight: 297,
+				Duplex:  true,
+				Formats: []ImageFormat{LisImgFormatBmp, LisImgFormatJpeg},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := NewFake(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			dev, err := lis.GetDevice(testDeviceID)
+			if err != nil || dev == nil {
+				t.Fatalf("GetDevice: %v, %v", dev, err)
+			}
+
+			//the unopened device is open for the call only
+			caps, err := dev.Capabilities()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := openDevices(t, lis); n != 0 {
+				t.Errorf("%d devices are left open", n)
+			}
+			if caps.DeviceID != testDeviceID || !reflect.DeepEqual(caps.Sources, tt.want) {
+				t.Errorf("got %+v, want %+v", caps.Sources, tt.want)
+			}
+
+			//an open device stays open
+			if err = dev.Open(); err != nil {
+				t.Fatal(err)
+			}
+			if caps, err = dev.Capabilities(); err != nil || len(caps.Sources) != len(tt.want) {
+				t.Fatalf("Capabilities of the open device: %v, %v", caps, err)
+			}
+			if n := openDevices(t, lis); n != 1 {
+				t.Errorf("%d devices are open, want 1", n)
+			}
+			dev.Close()
+
+			data, err := json.Marshal(caps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Capabilities
+			if err = json.Unmarshal(data, &loaded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&loaded, caps) {
+				t.Errorf("JSON %s is loaded as %+v", data, loaded)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/apex/log"
+	"github.com/foenixx/lisgo"
 )
 
 type (
@@ -20,6 +21,11 @@ type (
 		options    scannerOptions
 		verbose    bool
 		fileFormat string //file fileFormat: png, jpg, pdf
+		profile    string //options profile file (JSON or YAML)
+		paper      string //paper size preset
+		landscape  bool
+		nearest    bool //snap option values to the nearest legal ones
+		json       bool //print JSON instead of text
 	}
 )
 
@@ -28,12 +34,20 @@ const (
 	cmdPrintScanners = "print-scanners"
 	cmdPrintOptions  = "print-options"
 	cmdScan          = "scan"
-	generalUsage     = `usage: %s #{cmdPrintScanners}|#{cmdPrintOptions}|#{cmdScan}
+	cmdWorker        = "worker"
+	cmdSaveProfile   = "save-profile"
+	cmdTree          = "tree"
+	cmdCapabilities  = "capabilities"
+	generalUsage     = `usage: %s #{cmdPrintScanners}|#{cmdPrintOptions}|#{cmdTree}|#{cmdCapabilities}|#{cmdScan}|#{cmdSaveProfile}|#{cmdWorker}
 
 Commands:
 #{cmdPrintScanners}: find and print available scanners
 #{cmdPrintOptions}: print scanner and paper source options
+#{cmdTree}: print the item tree of the scanner
+#{cmdCapabilities}: print what the scanners can do: modes, resolutions, scan area, duplex, formats
 #{cmdScan}: scan using specified scanner and paper source
+#{cmdSaveProfile}: save paper source options to a file to use with #{cmdScan} -profile
+#{cmdWorker}: serve libinsane to the parent process over stdin/stdout (LISGO_BACKEND=worker)
 `
 )
 
@@ -42,18 +56,37 @@ var (
 		cmdPrintScanners: `usage: %s #{cmdPrintScanners} [-v]
 Find and print available scanners`,
 		cmdPrintOptions: `usage: %s #{cmdPrintOptions} [-d scanner] [-s paper_source] [filter options] [-v]
-Print scanner and paper source options
+Print paper source options, or options of the scanner itself if -s is omitted
 
 Options:
 `,
-		cmdScan: `usage: %s #{cmdScan} [-d scanner] [-s paper_source] [scan options] [-f file format] [-v]
+		cmdScan: `usage: %s #{cmdScan} [-d scanner] [-s paper_source] [-profile file] [-paper size [-landscape]] [scan options] [-f file format] [-v]
 Scan using specified scanner and paper source. Output file will have name like 'page1.png, page2.jpg or result.pdf' depending on -f option value. 
 
 Options:
 `,
+		cmdSaveProfile: `usage: %s #{cmdSaveProfile} [-d scanner] [-s paper_source] [scan options] [-p file] [-v]
+Save all readable and writable options of the paper source (after applying scan options) to a file.
+The file is YAML if its extension is .yaml or .yml and JSON otherwise.
+
+Options:
+`,
+		cmdTree: `usage: %s #{cmdTree} [-d scanner] [-v]
+Print the item tree of the scanner: the scanner itself, its paper sources and their children with types and option counts
+
+Options:
+`,
+		cmdCapabilities: `usage: %s #{cmdCapabilities} [-d scanner] [-json] [-v]
+Print capabilities of every paper source: modes, resolutions, maximum scan area, duplex and image formats.
+All scanners are printed if -d is omitted.
+
+Options:
+`,
+		cmdWorker: `usage: %s #{cmdWorker} [-v]
+Serve libinsane to the parent process over stdin/stdout. It's started by the library when LISGO_BACKEND=worker.`,
 	}
 
-	r = strings.NewReplacer("#{cmdPrintScanners}", cmdPrintScanners, "#{cmdPrintOptions}", cmdPrintOptions, "#{cmdScan}", cmdScan)
+	r = strings.NewReplacer("#{cmdPrintScanners}", cmdPrintScanners, "#{cmdPrintOptions}", cmdPrintOptions, "#{cmdScan}", cmdScan, "#{cmdWorker}", cmdWorker, "#{cmdSaveProfile}", cmdSaveProfile, "#{cmdTree}", cmdTree, "#{cmdCapabilities}", cmdCapabilities)
 )
 
 func (f *scannerOptions) String() string {
@@ -84,6 +117,18 @@ func (f *scannerOptions) Set(value string) error {
 	return nil
 }
 
+func paperSizeNames() string {
+	var names []string
+	for _, p := range lisgo.PaperSizes() {
+		names = append(names, p.Name)
+	}
+	return "[" + strings.Join(names, "|") + "]"
+}
+
+func addNearestFlag(fs *flag.FlagSet, flags *cliFlags) {
+	fs.BoolVar(&flags.nearest, "nearest", false, "snap -o values to the nearest legal values instead of failing")
+}
+
 func addCommonFlags(fs *flag.FlagSet, flags *cliFlags) {
 	fs.BoolVar(&flags.verbose, "v", false, "show debug messages")
 }
@@ -119,7 +164,11 @@ Format:
 -o name=value :  set option with [name] to [value]
 -o name= : pass empty string as value of the option
 This flag can appear multiple times: -o name1=value1 -o name2=value2`)
+		addNearestFlag(fs, &flags)
 		fs.StringVar(&flags.fileFormat, "f", "pdf", "output file format [jpg|png|pdf]")
+		fs.StringVar(&flags.profile, "profile", "", r.Replace("apply options saved by #{cmdSaveProfile} before -o options"))
+		fs.StringVar(&flags.paper, "paper", "", "set the scan area to the paper size before -o options "+paperSizeNames())
+		fs.BoolVar(&flags.landscape, "landscape", false, "use landscape orientation of -paper")
 		fs.Usage = func() {
 			fmt.Fprintf(flag.CommandLine.Output(), r.Replace(cmdUsage[cmdScan]), exec)
 			fs.PrintDefaults()
@@ -135,7 +184,7 @@ This flag can appear multiple times: -o name1=value1 -o name2=value2`)
 			log.Fatalf(r.Replace("#{cmdScan}: invalid command"))
 		}
 		switch flags.fileFormat {
-		case "png","jpg","pdf":
+		case "png", "jpg", "pdf":
 		default:
 			fs.Usage()
 			log.Fatalf(r.Replace("#{cmdScan}: invalid file format"))
@@ -143,12 +192,40 @@ This flag can appear multiple times: -o name1=value1 -o name2=value2`)
 
 		return &flags
 
+	case cmdSaveProfile:
+		fs = flag.NewFlagSet(cmdSaveProfile, flag.ExitOnError)
+		addCommonFlags(fs, &flags)
+		fs.StringVar(&flags.device, "d", "", "id of the scanner, mandatory")
+		fs.StringVar(&flags.source, "s", "", "paper source, mandatory")
+		fs.Var(&flags.options, "o", `set specified option before saving.
+Format:
+-o name=value :  set option with [name] to [value]
+This flag can appear multiple times: -o name1=value1 -o name2=value2`)
+		addNearestFlag(fs, &flags)
+		fs.StringVar(&flags.profile, "p", "profile.json", "output file")
+		fs.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), r.Replace(cmdUsage[cmdSaveProfile]), exec)
+			fs.PrintDefaults()
+		}
+
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			fs.Usage()
+			log.Fatalf(err.Error())
+		}
+
+		if flags.device == "" || flags.source == "" || flags.profile == "" {
+			fs.Usage()
+			log.Fatalf(r.Replace("#{cmdSaveProfile}: invalid command"))
+		}
+
+		return &flags
+
 	case cmdPrintOptions:
 
 		fs = flag.NewFlagSet(cmdPrintOptions, flag.ExitOnError)
 		addCommonFlags(fs, &flags)
 		fs.StringVar(&flags.device, "d", "", "id of the scanner, mandatory")
-		fs.StringVar(&flags.source, "s", "", "paper source, mandatory")
+		fs.StringVar(&flags.source, "s", "", "paper source, the scanner options are printed if omitted")
 		fs.Var(&flags.options, "o", `try to set specified option before printing.
 If this flag is specified, the output will be filtered by provided options.
 
@@ -157,6 +234,7 @@ Format:
 -o name= : pass empty string as value of the option
 -o name : just filter options list by the option name
 This flag can appear multiple times: -o name1=value1 -o name2=value2`)
+		addNearestFlag(fs, &flags)
 		fs.Usage = func() {
 			fmt.Fprintf(flag.CommandLine.Output(), r.Replace(cmdUsage[cmdPrintOptions]), exec)
 			fs.PrintDefaults()
@@ -167,7 +245,7 @@ This flag can appear multiple times: -o name1=value1 -o name2=value2`)
 			log.Fatalf(err.Error())
 		}
 
-		if flags.device == "" || flags.source == "" {
+		if flags.device == "" {
 			fs.Usage()
 			log.Fatalf(r.Replace("#{cmdPrintOptions}: invalid command"))
 		}
@@ -191,6 +269,52 @@ This flag can appear multiple times: -o name1=value1 -o name2=value2`)
 		}
 		return &flags
 
+	case cmdTree:
+		fs = flag.NewFlagSet(cmdTree, flag.ExitOnError)
+		addCommonFlags(fs, &flags)
+		fs.StringVar(&flags.device, "d", "", "id of the scanner, mandatory")
+		fs.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), r.Replace(cmdUsage[cmdTree]), exec)
+			fs.PrintDefaults()
+		}
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			fs.Usage()
+			log.Fatalf(err.Error())
+		}
+		if flags.device == "" {
+			fs.Usage()
+			log.Fatalf(r.Replace("#{cmdTree}: invalid command"))
+		}
+		return &flags
+
+	case cmdCapabilities:
+		fs = flag.NewFlagSet(cmdCapabilities, flag.ExitOnError)
+		addCommonFlags(fs, &flags)
+		fs.StringVar(&flags.device, "d", "", "id of the scanner, all scanners if omitted")
+		fs.BoolVar(&flags.json, "json", false, "print JSON")
+		fs.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), r.Replace(cmdUsage[cmdCapabilities]), exec)
+			fs.PrintDefaults()
+		}
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			fs.Usage()
+			log.Fatalf(err.Error())
+		}
+		return &flags
+
+	case cmdWorker:
+		fs = flag.NewFlagSet(cmdWorker, flag.ExitOnError)
+		addCommonFlags(fs, &flags)
+		fs.Usage = func() {
+			fmt.Fprintf(flag.CommandLine.Output(), r.Replace(cmdUsage[cmdWorker]), exec)
+			fs.PrintDefaults()
+		}
+		if err := fs.Parse(os.Args[2:]); err != nil {
+			fs.Usage()
+			log.Fatalf(err.Error())
+		}
+		return &flags
+
 	default:
 		flag.Usage()
 		log.Fatalf("error: incorrect command")
@@ -1,15 +1,18 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
-	"image/jpeg"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
 	"github.com/foenixx/lisgo"
-	"github.com/oliverpool/gofpdf"
+	"github.com/mattn/go-isatty"
 )
 
 func printOption(o *lisgo.OptionDescriptor) {
@@ -17,7 +20,7 @@ func printOption(o *lisgo.OptionDescriptor) {
 	fmt.Println(o)
 }
 
-func printOptions(device string, source string, options *scannerOptions) {
+func printOptions(device string, source string, options *scannerOptions, nearest bool) {
 	log.WithField("scanner", device).WithField("paper source", source).Info("printing options")
 
 	lis, err := lisgo.New()
@@ -36,90 +39,75 @@ func printOptions(device string, source string, options *scannerOptions) {
 	}
 	defer d.Close()
 
-	s, err := d.GetPaperSource(source)
-	if err != nil {
-		panic(err)
-	}
-	if s == nil {
-		log.WithField("paper source", source).Error("cannot find paper source")
-		d.Close()
-		return
-	}
-
-	for key, val := range *options {
-		if val == optionFilterOnly {
-			continue
-		}
-		err = s.SetOption(key, val)
-	}
-
-	if len(*options) == 0 {
-		err = s.IterateOptions(func(o *lisgo.OptionDescriptor) bool {
-			printOption(o)
-			return true
-		})
-
+	//options of the device itself if there is no paper source
+	var s optionSource = d
+	if source != "" {
+		ps, err := d.GetPaperSource(source)
 		if err != nil {
 			panic(err)
 		}
-		return
-	}
-
-	err = s.IterateOptions(func(o *lisgo.OptionDescriptor) bool {
-		if _, ok := (*options)[o.Name]; ok {
-			printOption(o)
+		if ps == nil {
+			log.WithField("paper source", source).Error("cannot find paper source")
+			return
 		}
-		return true
-	})
-	if err != nil {
-		panic(err)
+		s = ps
 	}
 
-}
+	if err = setOptions(s, options, nearest); err != nil {
+		return
+	}
 
-func printScanners() {
-	lis, err := lisgo.New()
+	opts, err := s.Options()
 	if err != nil {
 		panic(err)
 	}
-	defer lis.Close()
-	scanners, err := lis.ListDevices()
-	if err != nil {
-		panic(err)
+	for _, o := range opts {
+		if _, ok := (*options)[o.Name]; ok || len(*options) == 0 {
+			printOption(o)
+		}
 	}
 
-	for _, d := range scanners {
-		color.Cyan("---------------------------------------------------------------------\n")
-		fmt.Printf("Device Id: ")
-		color.Cyan(d.DeviceID)
-		fmt.Printf("\nVendor: %v\nModel: %v\n", d.Vendor, d.Model)
+}
 
-		err = d.Open()
-		if err != nil {
-			log.WithError(err).Error("cannot acquire scanner")
+//optionSource is either a paper source or a device
+type optionSource interface {
+	Options() ([]*lisgo.OptionDescriptor, error)
+	SetOption(name string, val string) (*lisgo.SetResult, error)
+	SetOptionNearest(name string, val string) (*lisgo.SetResult, error)
+}
+
+//setOptions sets options given with -o, FILTER_ONLY ones are skipped. With nearest the values are snapped to legal ones.
+func setOptions(s optionSource, options *scannerOptions, nearest bool) error {
+	for key, val := range *options {
+		if val == optionFilterOnly {
 			continue
 		}
-
-		err = d.IterateSources(func(s *lisgo.PaperSource) bool {
-			fmt.Printf("Paper source: ")
-			color.Green(s.Name)
-			return true
-		})
+		setOption := s.SetOption
+		if nearest {
+			setOption = s.SetOptionNearest
+		}
+		res, err := setOption(key, val)
 		if err != nil {
-			log.WithError(err).Error("cannot get paper sources")
+			log.WithError(err).WithField("option", key).Error("cannot set option")
+			return err
+		}
+		if res.Snapped {
+			log.WithField("option", key).WithField("requested", val).WithField("value", res.Value).Warn("option value is snapped to the nearest legal one")
+		}
+		if res.Inexact {
+			log.WithField("option", key).WithField("value", res.Value).Warn("option value is adjusted by the driver")
 		}
-		d.Close()
 	}
+	return nil
 }
 
-func scanToImage(device string, source string, fileFormat string, options *scannerOptions) {
+func saveProfile(device string, source string, options *scannerOptions, nearest bool, profile string) {
 	lis, err := lisgo.New()
 	if err != nil {
 		panic(err)
 	}
 	defer lis.Close()
 	scanner, err := lis.GetDevice(device)
-
 	if err != nil {
 		panic(err)
 	}
@@ -133,125 +121,221 @@ func scanToImage(device string, source string, fileFormat string, options *scann
 	if err != nil {
 		panic(err)
 	}
-
-	for key, val := range *options {
-		if val == optionFilterOnly {
-			continue
-		}
-		err = ps.SetOption(key, val)
+	if ps == nil {
+		log.WithField("paper source", source).Error("cannot find paper source")
+		return
+	}
+	if err = setOptions(ps, options, nearest); err != nil {
+		return
 	}
 
-	var page *lisgo.PageReader
-
-	var params *lisgo.ScanParameters
-	session, err := ps.ScanStart()
+	p, err := ps.ExportOptions()
 	if err != nil {
 		panic(err)
 	}
-	pageNum := 1
-
-	for !session.EndOfFeed() {
-
-		params, err = session.GetScanParameters()
-		if err != nil {
-			panic(err)
-		}
-		page = lisgo.NewPageReader(session, params)
-		log.WithFields(log.Fields{
-			"fileFormat": params.ImageFormatStr(),
-			"w":          params.Width(),
-			"h":          params.Height(),
-			"image_size": params.ImageSize(),
-		}).Debug("scanning parameters")
-
-		imgName := fmt.Sprintf("page%d.%s", pageNum, fileFormat)
-		err = page.WriteToFile(imgName, fileFormat)
-
-		if err != nil {
-			log.WithError(err).Error("cannot write output file")
-			panic(err)
-		}
-
-		pageNum++
+	if err = lisgo.SaveProfile(profile, p); err != nil {
+		log.WithError(err).Error("cannot write profile")
+		panic(err)
 	}
-
+	fmt.Printf("%d options saved to %s\n", len(p.Options), profile)
 }
 
-func scanToPdf(device string, source string, options *scannerOptions) {
+func printTree(device string) {
 	lis, err := lisgo.New()
 	if err != nil {
 		panic(err)
 	}
 	defer lis.Close()
-	scanner, err := lis.GetDevice(device)
-
+	d, err := lis.GetDevice(device)
 	if err != nil {
 		panic(err)
 	}
-	err = scanner.Open()
+	if err = d.Open(); err != nil {
+		panic(err)
+	}
+	defer d.Close()
+
+	root, err := d.Root()
 	if err != nil {
 		panic(err)
 	}
-	defer scanner.Close()
+	err = root.Walk(func(item *lisgo.Item, depth int) bool {
+		count := "?"
+		if opts, err := item.Options(); err != nil {
+			log.WithError(err).WithField("item", item.Name).Error("cannot get options")
+		} else {
+			count = fmt.Sprint(len(opts))
+		}
+		fmt.Printf("%s", strings.Repeat("  ", depth))
+		color.New(color.FgGreen).Print(item.Name)
+		fmt.Printf(" [%s] options: %s\n", item.Type(), count)
+		return true
+	})
+	if err != nil {
+		log.WithError(err).Error("cannot walk the item tree")
+	}
+}
 
-	ps, err := scanner.GetPaperSource(source)
+func printCapabilities(device string, asJSON bool) {
+	lis, err := lisgo.New()
 	if err != nil {
 		panic(err)
 	}
+	defer lis.Close()
 
-	for key, val := range *options {
-		if val == optionFilterOnly {
+	var devices []*lisgo.Scanner
+	if device != "" {
+		d, err := lis.GetDevice(device)
+		if err != nil {
+			panic(err)
+		}
+		if d == nil {
+			log.WithField("scanner", device).Error("cannot find scanner")
+			return
+		}
+		devices = append(devices, d)
+	} else if devices, err = lis.ListDevices(); err != nil {
+		panic(err)
+	}
+
+	res := make([]*lisgo.Capabilities, 0, len(devices))
+	for _, d := range devices {
+		caps, err := d.Capabilities()
+		if err != nil {
+			log.WithError(err).WithField("scanner", d.DeviceID).Error("cannot get capabilities")
 			continue
 		}
-		err = ps.SetOption(key, val)
+		res = append(res, caps)
 	}
 
-	var page *lisgo.PageReader
+	if asJSON {
+		data, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	for _, caps := range res {
+		color.Cyan("---------------------------------------------------------------------\n")
+		fmt.Printf("Device Id: ")
+		color.Cyan(caps.DeviceID)
+		for _, s := range caps.Sources {
+			fmt.Printf("\nPaper source: ")
+			color.Green("%s (%s)", s.Name, s.Kind)
+			fmt.Printf("Modes: %v\n", s.Modes)
+			if s.ResolutionRange != nil {
+				fmt.Printf("Resolutions: %d-%d dpi, step %d\n", s.ResolutionRange.Min, s.ResolutionRange.Max, s.ResolutionRange.Step)
+			} else {
+				fmt.Printf("Resolutions: %v dpi\n", s.Resolutions)
+			}
+			fmt.Printf("Max scan area: %.1f x %.1f mm\n", s.MaxWidth, s.MaxHeight)
+			fmt.Printf("Duplex: %v\n", s.Duplex)
+			fmt.Printf("Formats: %v\n", s.Formats)
+		}
+	}
+}
 
-	var params *lisgo.ScanParameters
-	session, err := ps.ScanStart()
+func printScanners() {
+	lis, err := lisgo.New()
+	if err != nil {
+		panic(err)
+	}
+	defer lis.Close()
+	scanners, err := lis.ListDevices()
 	if err != nil {
 		panic(err)
 	}
-	pageNum := 1
-
-	var opt = gofpdf.ImageOptions{ImageType: "jpeg"}
-
-	pdf := gofpdf.New("P", "mm", "A4", "")
 
-	for !session.EndOfFeed() {
+	for _, d := range scanners {
+		color.Cyan("---------------------------------------------------------------------\n")
+		fmt.Printf("Device Id: ")
+		color.Cyan(d.DeviceID)
+		fmt.Printf("\nVendor: %v\nModel: %v\n", d.Vendor, d.Model)
 
-		params, err = session.GetScanParameters()
+		err = d.Open()
 		if err != nil {
-			panic(err)
+			log.WithError(err).Error("cannot acquire scanner")
+			continue
 		}
-		page = lisgo.NewPageReader(session, params)
-		log.Debug("---- parameters -----")
-		log.Debugf("%+v", params)
-
-		pdf.AddPage()
 
-		var buf = bytes.Buffer{}
-		img, err := page.GetImage()
+		err = d.IterateSources(func(s *lisgo.PaperSource) bool {
+			fmt.Printf("Paper source: ")
+			color.Green(s.Name)
+			return true
+		})
 		if err != nil {
-			panic(err)
+			log.WithError(err).Error("cannot get paper sources")
 		}
+		d.Close()
+	}
+}
+
+//progressPrinter draws the progress bar of the page on stderr, at most 10 times a second
+func progressPrinter() func(lisgo.Progress) {
+	var last time.Time
+	return func(p lisgo.Progress) {
+		if !p.Done && time.Since(last) < 100*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		printProgress(p)
+	}
+}
+
+func printProgress(p lisgo.Progress) {
+	const width = 30
+	if p.EstimatedTotal > 0 {
+		filled := int(p.Percent() * width / 100)
+		bar := strings.Repeat("#", filled) + strings.Repeat("-", width-filled)
+		fmt.Fprintf(os.Stderr, "\rpage %d [%s] %3.0f%%", p.Page+1, bar, p.Percent())
+	} else {
+		fmt.Fprintf(os.Stderr, "\rpage %d", p.Page+1)
+	}
+	fmt.Fprintf(os.Stderr, " %.1f MB, ~%d lines, %.2f MB/s ", float64(p.BytesRead)/1e6, p.EstimatedLines, p.BytesPerSecond/1e6)
+	if p.Done {
+		fmt.Fprintln(os.Stderr)
+	}
+}
 
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 50})
+//scan scans with the library's Scan, the sink depends on -f
+func scan(flags *cliFlags) {
+	req := lisgo.Request{
+		Device:  flags.device,
+		Source:  flags.source,
+		Paper:   flags.paper,
+		Options: make(map[string]string),
+		Nearest: flags.nearest,
+	}
+	for key, val := range flags.options {
+		if val != optionFilterOnly {
+			req.Options[key] = val
+		}
+	}
+	if flags.landscape {
+		req.Orientation = lisgo.Landscape
+	}
+	if flags.profile != "" {
+		p, err := lisgo.LoadProfile(flags.profile)
 		if err != nil {
-			panic(err)
+			log.WithError(err).Error("cannot load profile")
+			return
 		}
+		req.Profile = p
+	}
 
-		imgName := fmt.Sprintf("page%d.jpg", pageNum)
-		pdf.RegisterImageOptionsReader(imgName, opt, &buf)
-		//// A4 210.0 x 297.0
-		pdf.ImageOptions(imgName, 0, 0, 210, 297, false, opt, 0, "")
-		//err = page.WriteToJpeg(fmt.Sprintf("page%d.jpg", pageNum))
-		pageNum++
+	if !flags.verbose && isatty.IsTerminal(os.Stderr.Fd()) {
+		req.Progress = progressPrinter()
 	}
-	err = pdf.OutputFileAndClose("result.pdf")
-	if err != nil {
-		log.WithError(err).Error("cannot write pdf")
+
+	var sink lisgo.PageSink
+	if flags.fileFormat == "pdf" {
+		sink = lisgo.NewPdfSink("result.pdf")
+	} else {
+		sink = lisgo.NewFileSink("page%d."+flags.fileFormat, flags.fileFormat)
+	}
+	if err := lisgo.Scan(context.Background(), req, sink); err != nil {
+		log.WithError(err).Error("cannot scan")
 		panic(err)
 	}
 }
@@ -273,12 +357,19 @@ func main() {
 	case cmdPrintScanners:
 		printScanners()
 	case cmdPrintOptions:
-		printOptions(flags.device, flags.source, &flags.options)
+		printOptions(flags.device, flags.source, &flags.options, flags.nearest)
 	case cmdScan:
-		if flags.fileFormat == "pdf" {
-			scanToPdf(flags.device, flags.source, &flags.options)
-		} else {
-			scanToImage(flags.device, flags.source, flags.fileFormat, &flags.options)
+		scan(flags)
+	case cmdSaveProfile:
+		saveProfile(flags.device, flags.source, &flags.options, flags.nearest, flags.profile)
+	case cmdTree:
+		printTree(flags.device)
+	case cmdCapabilities:
+		printCapabilities(flags.device, flags.json)
+	case cmdWorker:
+		//stdout belongs to the protocol, the log goes to stderr
+		if err := lisgo.ServeWorker(os.Stdin, os.Stdout); err != nil {
+			log.WithError(err).Fatal("worker has failed")
 		}
 	}
 }
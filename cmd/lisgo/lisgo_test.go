@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/fatih/color"
+	"github.com/foenixx/lisgo"
+)
+
+const testDeviceID = "fake:lisgo:Virtual Scanner"
+
+//TestMain makes the commands use the virtual scanner and print without colors
+func TestMain(m *testing.M) {
+	os.Setenv(lisgo.BackendEnvVar, lisgo.BackendFake)
+	color.NoColor = true
+	log.SetLevel(log.ErrorLevel)
+	os.Exit(m.Run())
+}
+
+//parseArgs parses the command line as main does
+func parseArgs(args ...string) *cliFlags {
+	saved := os.Args
+	defer func() { os.Args = saved }()
+	os.Args = append([]string{"lisgo"}, args...)
+	return parseFlags()
+}
+
+//captureOutput returns what f prints to stdout
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		done <- data
+	}()
+	stdout, output := os.Stdout, color.Output
+	os.Stdout, color.Output = w, w
+	defer func() {
+		os.Stdout, color.Output = stdout, output
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func TestPrintOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+	}{
+		{"device", []string{"-d", testDeviceID}, []string{"lamp_off_time", "Value: 15"}, []string{"resolution", "mode"}},
+		{"device set", []string{"-d", testDeviceID, "-o", "lamp_off_time=30"}, []string{"lamp_off_time", "Value: 30"}, []string{"resolution"}},
+		{"source", []string{"-d", testDeviceID, "-s", "flatbed"}, []string{"resolution", "mode"}, []string{"lamp_off_time"}},
+		{"source filter", []string{"-d", testDeviceID, "-s", "feeder", "-o", "mode"}, []string{"mode"}, []string{"resolution", "lamp_off_time"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := parseArgs(append([]string{cmdPrintOptions}, tt.args...)...)
+			out := captureOutput(t, func() {
+				printOptions(flags.device, flags.source, &flags.options, flags.nearest)
+			})
+			for _, s := range tt.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("%q is not printed:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(out, "------- "+s+" ------") {
+					t.Errorf("%s is printed:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintTree(t *testing.T) {
+	flags := parseArgs(cmdTree, "-d", testDeviceID)
+	out := captureOutput(t, func() { printTree(flags.device) })
+	want := testDeviceID + ` [Device] options: 1
+  flatbed [Flatbed] options: 7
+  feeder [ADF] options: 7
+    front [ADF] options: 7
+    back [ADF] options: 7
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestPrintCapabilitiesJSON(t *testing.T) {
+	for _, args := range [][]string{{"-json"}, {"-json", "-d", testDeviceID}} {
+		flags := parseArgs(append([]string{cmdCapabilities}, args...)...)
+		out := captureOutput(t, func() { printCapabilities(flags.device, flags.json) })
+		var caps []*lisgo.Capabilities
+		if err := json.Unmarshal([]byte(out), &caps); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+		if len(caps) != 1 || caps[0].DeviceID != testDeviceID || len(caps[0].Sources) != 2 {
+			t.Fatalf("%v: got %s", args, out)
+		}
+		feeder := caps[0].Sources[1]
+		if feeder.Name != "feeder" || feeder.Kind != lisgo.LisItemAdf || len(feeder.Resolutions) != 4 ||
+			feeder.MaxWidth != 215.9 || feeder.MaxHeight != 297 || feeder.Duplex {
+			t.Errorf("%v: feeder is %+v", args, feeder)
+		}
+		//kinds, modes and formats are written by name
+		for _, s := range []string{`"kind": "ADF"`, `"kind": "Flatbed"`, `"BW"`, `"Gray"`, `"Color"`} {
+			if !strings.Contains(out, s) {
+				t.Errorf("%v: %s is not printed:\n%s", args, s, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package lisgo
+
+import (
+	"sync"
+	"time"
+)
+
+//ListOptions control ListDevicesWith
+type ListOptions struct {
+	//Locations is LisDeviceLocationsAny (default) or LisDeviceLocationsLocalOnly to skip network scanners
+	Locations uint32
+	//Refresh enumerates devices even if the cached list is fresh
+	Refresh bool
+}
+
+//deviceCache keeps the last lists of device descriptors, one per location
+type deviceCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	lists map[uint32]deviceList
+}
+
+type deviceList struct {
+	devices []*Scanner
+	at      time.Time
+}
+
+//SetDeviceCacheTTL makes ListDevices and GetDevice reuse the list of devices for ttl after
+//enumeration. Zero ttl (default) disables the cache. The cached list is dropped in any case.
+func (o *lisgo) SetDeviceCacheTTL(ttl time.Duration) {
+	o.cache.mu.Lock()
+	defer o.cache.mu.Unlock()
+	o.cache.ttl = ttl
+	o.cache.lists = nil
+}
+
+func (o *lisgo) cacheDevices(locations uint32, devices []*Scanner) {
+	o.cache.mu.Lock()
+	defer o.cache.mu.Unlock()
+	if o.cache.ttl <= 0 {
+		return
+	}
+	if o.cache.lists == nil {
+		o.cache.lists = make(map[uint32]deviceList)
+	}
+	o.cache.lists[locations] = deviceList{devices: copyDevices(devices), at: time.Now()}
+}
+
+//cachedDevices returns a copy of the fresh list of devices or nil
+func (o *lisgo) cachedDevices(locations uint32) []*Scanner {
+	o.cache.mu.Lock()
+	defer o.cache.mu.Unlock()
+	if l, ok := o.cache.lists[locations]; ok && time.Since(l.at) < o.cache.ttl {
+		return copyDevices(l.devices)
+	}
+	return nil
+}
+
+//cachedDevice looks for the device in all the fresh lists
+func (o *lisgo) cachedDevice(deviceID string) *Scanner {
+	o.cache.mu.Lock()
+	defer o.cache.mu.Unlock()
+	for _, l := range o.cache.lists {
+		if time.Since(l.at) >= o.cache.ttl {
+			continue
+		}
+		for _, d := range l.devices {
+			if d.DeviceID == deviceID {
+				dev := *d
+				return &dev
+			}
+		}
+	}
+	return nil
+}
+
+//copyDevices copies descriptors, so opening of a returned device doesn't affect the cache
+func copyDevices(devices []*Scanner) []*Scanner {
+	res := make([]*Scanner, 0, len(devices))
+	for _, d := range devices {
+		dev := *d
+		dev.lisDevice = nil
+		res = append(res, &dev)
+	}
+	return res
+}
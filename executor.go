@@ -0,0 +1,116 @@
+package lisgo
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+//ErrClosed is returned by the calls made after the API instance is closed, and by the calls which need
+//an open scanner before Scanner.Open or after Scanner.Close
+var ErrClosed = errors.New("lisgo: use of closed handle")
+
+//executor runs functions one by one on a goroutine locked to its OS thread.
+//libinsane backends (TWAIN in particular) expect all calls to come from the thread that initialised them.
+type executor struct {
+	calls    chan func()
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	current string    //name of the running call, empty if idle
+	started time.Time //when the running call has started
+}
+
+func newExecutor() *executor {
+	e := executor{calls: make(chan func()), stopped: make(chan struct{})}
+	go e.loop()
+	return &e
+}
+
+func (e *executor) loop() {
+	//the thread is never unlocked, so it's terminated together with the goroutine
+	runtime.LockOSThread()
+	for {
+		select {
+		case f := <-e.calls:
+			f()
+		case <-e.stopped:
+			return
+		}
+	}
+}
+
+//do runs f on the executor thread, waits for it to return and returns its error. Name is the C proxy called by f,
+//it's reported by the watchdog if the call stalls. Must not be called from f itself.
+//f isn't run and ErrClosed is returned once the executor is stopped.
+func (e *executor) do(name string, f func() error) error {
+	done := make(chan struct{})
+	var err error
+	call := func() {
+		defer close(done)
+		e.setCurrent(name)
+		defer e.setCurrent("")
+		err = f()
+	}
+	select {
+	case e.calls <- call:
+	case <-e.stopped:
+		return ErrClosed
+	}
+	<-done
+	return err
+}
+
+func (e *executor) setCurrent(name string) {
+	e.mu.Lock()
+	e.current = name
+	e.started = time.Now()
+	e.mu.Unlock()
+}
+
+//currentCall returns the name of the running call and how long it's been running
+func (e *executor) currentCall() (string, time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == "" {
+		return "", 0
+	}
+	return e.current, time.Since(e.started)
+}
+
+//minWatchPeriod keeps the period of the watchdog positive for tiny thresholds
+const minWatchPeriod = time.Millisecond
+
+//watch calls report once for every call running longer than threshold, until stop is closed
+func (e *executor) watch(threshold time.Duration, report func(call string, elapsed time.Duration), stop <-chan struct{}) {
+	period := threshold / 2
+	if period < minWatchPeriod {
+		period = minWatchPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	var reported time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.mu.Lock()
+			call, started := e.current, e.started
+			e.mu.Unlock()
+			if call != "" && started != reported && time.Since(started) >= threshold {
+				reported = started
+				report(call, time.Since(started))
+			}
+		}
+	}
+}
+
+//stop terminates the executor thread after the running call is done, it may be called more than once
+func (e *executor) stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopped)
+	})
+}
@@ -0,0 +1,65 @@
+package lisgo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecutorStop(t *testing.T) {
+	e := newExecutor()
+	want := errors.New("call failed")
+	if err := e.do("test", func() error { return want }); err != want {
+		t.Fatalf("do returned %v, want %v", err, want)
+	}
+	e.stop()
+	e.stop()
+	called := false
+	if err := e.do("test", func() error { called = true; return nil }); err != ErrClosed {
+		t.Errorf("do after stop returned %v, want ErrClosed", err)
+	}
+	if called {
+		t.Error("do after stop has run the function")
+	}
+}
+
+func TestExecutorWatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+	}{
+		{"nanosecond", time.Nanosecond},
+		{"millisecond", time.Millisecond},
+		{"regular", 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExecutor()
+			defer e.stop()
+			stop := make(chan struct{})
+			reports := make(chan string, 10)
+			go e.watch(tt.threshold, func(call string, elapsed time.Duration) {
+				reports <- call
+			}, stop)
+			err := e.do("slow_proxy", func() error {
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			})
+			close(stop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case call := <-reports:
+				if call != "slow_proxy" {
+					t.Errorf("got %s, want slow_proxy", call)
+				}
+			default:
+				t.Fatal("the stalled call isn't reported")
+			}
+			if len(reports) != 0 {
+				t.Errorf("the call is reported %d more times", len(reports))
+			}
+		})
+	}
+}
@@ -0,0 +1,658 @@
+package lisgo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	//FakeConfig describes virtual scanners served by the fake backend
+	FakeConfig struct {
+		Devices []*FakeDevice
+	}
+
+	//FakeDevice is a virtual scanner
+	FakeDevice struct {
+		DeviceID string
+		Vendor   string
+		Model    string
+		Type     string
+		Sources  []*FakeSource
+		//Options of the device item itself, there are none if nil
+		Options []*FakeOption
+	}
+
+	//FakeSource is a paper source of a virtual scanner
+	FakeSource struct {
+		Name string
+		//Kind is LisItemFlatbed or LisItemAdf
+		Kind ItemType
+		//Pages is the count of pages returned by a scan session. ScanStart fails if there are no pages.
+		Pages int
+		//ReadDelay slows down every scan_read to emulate a slow or stuck device
+		ReadDelay time.Duration
+		//WarmUp delays the first scan_read of a session to emulate warming lamp
+		WarmUp time.Duration
+		//Options of the paper source, DefaultFakeOptions() are used if nil
+		Options []*FakeOption
+		//Children are nested items, e.g. front and back of a feeder
+		Children []*FakeSource
+	}
+
+	//FakeOption is an option of a virtual paper source. Value is the initial value of the option.
+	FakeOption struct {
+		Name         string
+		Title        string
+		Desc         string
+		Capabilities int
+		ValueType    ValueType
+		ValueUnit    Unit
+		Constraint   *OptionConstraint
+		Value        *LisValue
+		//SetFlags are LisSetFlag* bits reported when the option is set
+		SetFlags int
+	}
+)
+
+//Fake image modes, the same values as libinsane uses for the "mode" option
+const (
+	FakeModeLineArt = string(ColorModeLineArt)
+	FakeModeGray    = string(ColorModeGray)
+	FakeModeColor   = string(ColorModeColor)
+)
+
+const (
+	fakeChunkSize         = 64 * 1024
+	fakeDefaultResolution = 150
+)
+
+type (
+	//fakeBackend implements backend with virtual scanners
+	fakeBackend struct {
+		mu       sync.Mutex
+		devices  []*FakeDevice
+		timeouts Timeouts
+		open     int //devices got and not closed yet
+	}
+
+	//fakeItem is either a virtual device (source == nil) or one of its paper sources
+	fakeItem struct {
+		b      *fakeBackend
+		dev    *FakeDevice
+		source *FakeSource
+	}
+
+	fakeOption struct {
+		b   *fakeBackend
+		opt *FakeOption
+	}
+
+	fakeSession struct {
+		pages      int
+		page       int
+		pageDone   bool
+		readDelay  time.Duration
+		warmUp     time.Duration
+		warmUpMax  time.Duration
+		cancelled  chan struct{}
+		cancelOnce sync.Once
+		data       []byte
+		offset     int
+		params     ScanParameters
+		render     func(page int) ([]byte, *ScanParameters)
+	}
+)
+
+//DefaultFakeConfig returns a single virtual scanner with a flatbed and a 3-pages feeder with front and back children.
+//The device itself has the lamp_off_time option (minutes).
+func DefaultFakeConfig() *FakeConfig {
+	return &FakeConfig{
+		Devices: []*FakeDevice{
+			{
+				DeviceID: "fake:lisgo:Virtual Scanner",
+				Vendor:   "lisgo",
+				Model:    "Virtual Scanner",
+				Type:     "flatbed scanner",
+				Sources: []*FakeSource{
+					{Name: "flatbed", Kind: LisItemFlatbed, Pages: 1},
+					{
+						Name: "feeder", Kind: LisItemAdf, Pages: 3,
+						Children: []*FakeSource{
+							{Name: "front", Kind: LisItemAdf, Pages: 3},
+							{Name: "back", Kind: LisItemAdf, Pages: 3},
+						},
+					},
+				},
+				Options: []*FakeOption{
+					{
+						Name: "lamp_off_time", Title: "Lamp off time", Desc: "Turns the lamp off after the given minutes of inactivity.",
+						Capabilities: LisCapSwSelect,
+						ValueType:    LisTypeInteger,
+						Constraint: &OptionConstraint{
+							ConstraintType: LisConstraintRange,
+							PossibleRange: &ValueRange{
+								MinValue: &LisValue{ValType: LisTypeInteger, IntValue: 0},
+								MaxValue: &LisValue{ValType: LisTypeInteger, IntValue: 60},
+								Interval: &LisValue{ValType: LisTypeInteger, IntValue: 1},
+							},
+						},
+						Value: &LisValue{ValType: LisTypeInteger, IntValue: 15},
+					},
+				},
+			},
+		},
+	}
+}
+
+//DefaultFakeOptions returns resolution, mode and scan area options with list and range constraints
+func DefaultFakeOptions() []*FakeOption {
+	mmRange := func(max float64) *OptionConstraint {
+		return &OptionConstraint{
+			ConstraintType: LisConstraintRange,
+			PossibleRange: &ValueRange{
+				MinValue: &LisValue{ValType: LisTypeDouble, DoubleValue: 0},
+				MaxValue: &LisValue{ValType: LisTypeDouble, DoubleValue: max},
+				Interval: &LisValue{ValType: LisTypeDouble, DoubleValue: 0},
+			},
+		}
+	}
+	mmOption := func(name, title string, max, val float64) *FakeOption {
+		return &FakeOption{
+			Name: name, Title: title, Desc: title,
+			Capabilities: LisCapSwSelect,
+			ValueType:    LisTypeDouble,
+			ValueUnit:    LisUnitMM,
+			Constraint:   mmRange(max),
+			Value:        &LisValue{ValType: LisTypeDouble, DoubleValue: val},
+			SetFlags:     LisSetFlagMustReloadParams,
+		}
+	}
+	return []*FakeOption{
+		{
+			Name: "resolution", Title: "Scan resolution", Desc: "Sets the resolution of the scanned image.",
+			Capabilities: LisCapSwSelect,
+			ValueType:    LisTypeInteger,
+			ValueUnit:    LisUnitDPI,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintList,
+				PossibleList: ValueList{
+					{ValType: LisTypeInteger, IntValue: 75},
+					{ValType: LisTypeInteger, IntValue: 150},
+					{ValType: LisTypeInteger, IntValue: 300},
+					{ValType: LisTypeInteger, IntValue: 600},
+				},
+			},
+			Value:    &LisValue{ValType: LisTypeInteger, IntValue: fakeDefaultResolution},
+			SetFlags: LisSetFlagMustReloadParams,
+		},
+		{
+			Name: "mode", Title: "Scan mode", Desc: "Selects the scan mode (e.g., lineart, monochrome, or color).",
+			Capabilities: LisCapSwSelect,
+			ValueType:    LisTypeString,
+			ValueUnit:    LisUnitNone,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintList,
+				PossibleList: ValueList{
+					{ValType: LisTypeString, StringValue: FakeModeLineArt},
+					{ValType: LisTypeString, StringValue: FakeModeGray},
+					{ValType: LisTypeString, StringValue: FakeModeColor},
+				},
+			},
+			Value:    &LisValue{ValType: LisTypeString, StringValue: FakeModeColor},
+			SetFlags: LisSetFlagMustReloadParams,
+		},
+		{
+			Name: "brightness", Title: "Brightness", Desc: "Controls the brightness of the acquired image.",
+			Capabilities: LisCapSwSelect,
+			ValueType:    LisTypeInteger,
+			ValueUnit:    LisUnitNone,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintRange,
+				PossibleRange: &ValueRange{
+					MinValue: &LisValue{ValType: LisTypeInteger, IntValue: -100},
+					MaxValue: &LisValue{ValType: LisTypeInteger, IntValue: 100},
+					Interval: &LisValue{ValType: LisTypeInteger, IntValue: 1},
+				},
+			},
+			Value: &LisValue{ValType: LisTypeInteger, IntValue: 0},
+		},
+		mmOption("tl-x", "Top-left x", 215.9, 0),
+		mmOption("tl-y", "Top-left y", 297, 0),
+		mmOption("br-x", "Bottom-right x", 215.9, 215.9),
+		mmOption("br-y", "Bottom-right y", 297, 297),
+	}
+}
+
+//newFakeBackend copies the config, so option values set thru one API instance don't leak into another
+func newFakeBackend(cfg *FakeConfig) *fakeBackend {
+	b := fakeBackend{}
+	for _, d := range cfg.Devices {
+		dev := *d
+		dev.Sources = nil
+		dev.Options = copyFakeOptions(d.Options)
+		for _, s := range d.Sources {
+			dev.Sources = append(dev.Sources, copyFakeSource(s))
+		}
+		b.devices = append(b.devices, &dev)
+	}
+	return &b
+}
+
+func copyFakeSource(s *FakeSource) *FakeSource {
+	src := *s
+	opts := s.Options
+	if opts == nil {
+		opts = DefaultFakeOptions()
+	}
+	src.Options = copyFakeOptions(opts)
+	src.Children = nil
+	for _, c := range s.Children {
+		src.Children = append(src.Children, copyFakeSource(c))
+	}
+	return &src
+}
+
+func copyFakeOptions(opts []*FakeOption) []*FakeOption {
+	var res []*FakeOption
+	for _, o := range opts {
+		opt := *o
+		if o.Value != nil {
+			val := *o.Value
+			opt.Value = &val
+		}
+		res = append(res, &opt)
+	}
+	return res
+}
+
+func (b *fakeBackend) cleanup() {
+}
+
+func (b *fakeBackend) setTimeouts(t Timeouts) {
+	b.mu.Lock()
+	b.timeouts = t
+	b.mu.Unlock()
+}
+
+func (b *fakeBackend) getTimeouts() Timeouts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.timeouts
+}
+
+func (b *fakeBackend) currentCall() (string, time.Duration) {
+	return "", 0
+}
+
+//listDevices ignores locations, virtual scanners are always local
+func (b *fakeBackend) listDevices(locations uint32) ([]*Scanner, error) {
+	devices := make([]*Scanner, 0)
+	for _, d := range b.devices {
+		devices = append(devices, &Scanner{
+			DeviceID: d.DeviceID,
+			Vendor:   d.Vendor,
+			Model:    d.Model,
+			Type:     d.Type,
+		})
+	}
+	return devices, nil
+}
+
+func (b *fakeBackend) getDevice(deviceID string) (backendItem, error) {
+	for _, d := range b.devices {
+		if d.DeviceID == deviceID {
+			b.mu.Lock()
+			b.open++
+			b.mu.Unlock()
+			return &fakeItem{b: b, dev: d}, nil
+		}
+	}
+	return nil, newError(LisErrInvalidValue, "fake_get_device", fmt.Sprintf("device '%s' not found", deviceID))
+}
+
+func (i *fakeItem) name() string {
+	if i.source == nil {
+		return i.dev.DeviceID
+	}
+	return i.source.Name
+}
+
+func (i *fakeItem) kind() ItemType {
+	if i.source == nil {
+		return LisItemDevice
+	}
+	return i.source.Kind
+}
+
+//close releases the device, like libinsane the paper sources are released with it
+func (i *fakeItem) close() {
+	if i.source == nil {
+		i.b.mu.Lock()
+		i.b.open--
+		i.b.mu.Unlock()
+	}
+}
+
+//openDevices returns the count of devices got and not closed yet
+func (b *fakeBackend) openDevices() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+func (i *fakeItem) children() ([]backendItem, error) {
+	var res []backendItem
+	sources := i.dev.Sources
+	if i.source != nil {
+		sources = i.source.Children
+	}
+	for _, s := range sources {
+		res = append(res, &fakeItem{b: i.b, dev: i.dev, source: s})
+	}
+	return res, nil
+}
+
+func (i *fakeItem) options() ([]*OptionDescriptor, error) {
+	var res []*OptionDescriptor
+	for _, o := range i.fakeOptions() {
+		res = append(res, &OptionDescriptor{
+			Name:         o.Name,
+			Title:        o.Title,
+			Desc:         o.Desc,
+			Capabilities: o.Capabilities,
+			ValueType:    o.ValueType,
+			ValueUnit:    o.ValueUnit,
+			Constraint:   o.Constraint,
+			opt:          &fakeOption{b: i.b, opt: o},
+		})
+	}
+	return res, nil
+}
+
+//fakeOptions returns the options of the paper source or of the device
+func (i *fakeItem) fakeOptions() []*FakeOption {
+	if i.source == nil {
+		return i.dev.Options
+	}
+	return i.source.Options
+}
+
+func (i *fakeItem) findOption(name string) *FakeOption {
+	for _, o := range i.fakeOptions() {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+//optionValue returns current value of the option or nil if there is no such option
+func (i *fakeItem) optionValue(name string) *LisValue {
+	opt := i.findOption(name)
+	if opt == nil || opt.Value == nil {
+		return nil
+	}
+	i.b.mu.Lock()
+	defer i.b.mu.Unlock()
+	v := *opt.Value
+	return &v
+}
+
+func (i *fakeItem) scanStart() (backendSession, error) {
+	if i.source == nil {
+		return nil, newError(LisErrUnsupported, "fake_scan_start", fmt.Sprintf("cannot scan from device '%s', choose a paper source", i.dev.DeviceID))
+	}
+	if i.source.Pages <= 0 {
+		return nil, newError(LisErrNoDocs, "fake_scan_start", i.source.Name)
+	}
+
+	mode := FakeModeColor
+	if v := i.optionValue(OptionMode); v != nil {
+		mode = v.StringValue
+	}
+	dpi := fakeDefaultResolution
+	if v := i.optionValue(OptionResolution); v != nil {
+		dpi = v.IntValue
+	}
+	area := [4]float64{0, 0, 215.9, 297}
+	for k, n := range []string{OptionTLX, OptionTLY, OptionBRX, OptionBRY} {
+		if v := i.optionValue(n); v != nil {
+			area[k] = v.DoubleValue
+		}
+	}
+	width := mmToPixels(area[2]-area[0], dpi)
+	height := mmToPixels(area[3]-area[1], dpi)
+	if width <= 0 || height <= 0 {
+		return nil, newError(LisErrInvalidValue, "fake_scan_start", fmt.Sprintf("empty scan area %v", area))
+	}
+
+	s := fakeSession{
+		pages:     i.source.Pages,
+		readDelay: i.source.ReadDelay,
+		warmUp:    i.source.WarmUp,
+		warmUpMax: i.b.getTimeouts().WarmUp,
+		cancelled: make(chan struct{}),
+		render: func(page int) ([]byte, *ScanParameters) {
+			data := fakePage(mode, width, height, dpi, page)
+			return data, &ScanParameters{
+				format:    LisImgFormatBmp,
+				width:     width,
+				height:    height,
+				imageSize: uint(len(data)),
+			}
+		},
+	}
+	s.startPage()
+	return &s, nil
+}
+
+func (s *fakeSession) startPage() {
+	data, params := s.render(s.page)
+	s.data = data
+	s.params = *params
+	s.offset = 0
+	s.pageDone = false
+}
+
+//nextPage moves to the next page if the current one is over
+func (s *fakeSession) nextPage() {
+	if s.pageDone && !s.endOfFeed() {
+		s.page++
+		s.startPage()
+	}
+}
+
+func (s *fakeSession) isCancelled() bool {
+	select {
+	case <-s.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *fakeSession) endOfFeed() bool {
+	return s.isCancelled() || (s.pageDone && s.page >= s.pages-1)
+}
+
+func (s *fakeSession) endOfPage() bool {
+	return s.isCancelled() || s.pageDone
+}
+
+func (s *fakeSession) scanParameters() (*ScanParameters, error) {
+	s.nextPage()
+	params := s.params
+	return &params, nil
+}
+
+func (s *fakeSession) scanRead(size int) ([]byte, error) {
+	if s.warmUp > 0 {
+		warmUp := s.warmUp
+		if s.warmUpMax > 0 && warmUp > s.warmUpMax {
+			warmUp = s.warmUpMax
+		}
+		s.sleep(warmUp)
+		s.warmUp -= warmUp
+		if s.warmUp > 0 {
+			return nil, &TimeoutError{Op: "WarmUp", Func: "fake_scan_read", Limit: s.warmUpMax}
+		}
+	}
+	s.sleep(s.readDelay)
+	if s.isCancelled() {
+		return nil, newError(LisErrCancelled, "fake_scan_read", "")
+	}
+	s.nextPage()
+	if s.pageDone {
+		return nil, nil
+	}
+	if size > fakeChunkSize {
+		size = fakeChunkSize
+	}
+	end := s.offset + size
+	if end >= len(s.data) {
+		end = len(s.data)
+		s.pageDone = true
+	}
+	chunk := s.data[s.offset:end]
+	s.offset = end
+	return chunk, nil
+}
+
+//sleep waits for d unless the session is cancelled
+func (s *fakeSession) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-time.After(d):
+	case <-s.cancelled:
+	}
+}
+
+func (s *fakeSession) cancel() {
+	s.cancelOnce.Do(func() {
+		close(s.cancelled)
+	})
+}
+
+func (s *fakeSession) close() {
+	s.data = nil
+}
+
+func (o *fakeOption) getValue() (*LisValue, error) {
+	o.b.mu.Lock()
+	defer o.b.mu.Unlock()
+	if o.opt.Value == nil {
+		return nil, newError(LisErrInvalidValue, "fake_get_value", fmt.Sprintf("option '%s' has no value", o.opt.Name))
+	}
+	v := *o.opt.Value
+	return &v, nil
+}
+
+//setValue reports the SetFlags of the option, the image size changes with resolution, mode and scan area
+func (o *fakeOption) setValue(v *LisValue) (int, error) {
+	if o.opt.Capabilities&LisCapSwSelect == 0 || o.opt.Capabilities&LisCapInactive != 0 {
+		return 0, newError(LisErrAccessDenied, "fake_set_value", fmt.Sprintf("option '%s' cannot be set", o.opt.Name))
+	}
+	if v.ValType != o.opt.ValueType || !fakeConstraintAllows(o.opt.Constraint, v) {
+		return 0, newError(LisErrInvalidValue, "fake_set_value", fmt.Sprintf("'%s' for option '%s'", v, o.opt.Name))
+	}
+	val := *v
+	o.b.mu.Lock()
+	o.opt.Value = &val
+	o.b.mu.Unlock()
+	return o.opt.SetFlags, nil
+}
+
+func fakeConstraintAllows(c *OptionConstraint, v *LisValue) bool {
+	if c == nil {
+		return true
+	}
+	switch c.ConstraintType {
+	case LisConstraintList:
+		for _, p := range c.PossibleList {
+			if p.equal(v) {
+				return true
+			}
+		}
+		return false
+	case LisConstraintRange:
+		return c.PossibleRange.contains(v)
+	}
+	return true
+}
+
+func mmToPixels(mm float64, dpi int) int {
+	return int(math.Round(mm / mmPerInch * float64(dpi)))
+}
+
+//fakePage renders a bottom-up BMP test pattern: checkers for LineArt, gradient for Gray and Color
+func fakePage(mode string, width, height, dpi, page int) []byte {
+	var bpp, colors uint32
+	switch strings.ToLower(mode) {
+	case strings.ToLower(FakeModeLineArt):
+		bpp, colors = 1, 2
+	case strings.ToLower(FakeModeGray):
+		bpp, colors = 8, 256
+	default:
+		bpp, colors = 24, 0
+	}
+	rowSize := int(pad4((uint32(width)*bpp + 7) / 8))
+	dataOffset := uint32(bmpHeaderSize) + colors*4
+	pixelsSize := uint32(rowSize * height)
+	ppm := uint32(math.Round(float64(dpi) * 1000 / mmPerInch))
+
+	header := BmpHeader{
+		Magic:                0x4D42, //"BM"
+		FileSize:             dataOffset + pixelsSize,
+		OffsetToData:         dataOffset,
+		HeaderSize:           bmp3HeaderSize,
+		Width:                uint32(width),
+		Height:               int32(height),
+		NbColorPlanes:        1,
+		NbBitsPerPixel:       uint16(bpp),
+		PixelDataSize:        pixelsSize,
+		HorizontalResolution: ppm,
+		VerticalResolution:   ppm,
+		NbColorsInPalette:    colors,
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, header.FileSize))
+	_ = binary.Write(buf, binary.LittleEndian, &header)
+	for c := uint32(0); c < colors; c++ {
+		g := byte(c * 255 / (colors - 1))
+		buf.Write([]byte{g, g, g, 0})
+	}
+
+	row := make([]byte, rowSize)
+	cell := dpi / 4
+	if cell == 0 {
+		cell = 1
+	}
+	for line := 0; line < height; line++ {
+		y := height - line - 1 //bottom-up
+		for i := range row {
+			row[i] = 0
+		}
+		for x := 0; x < width; x++ {
+			switch bpp {
+			case 1:
+				if (x/cell+y/cell+page)%2 == 0 {
+					row[x/8] |= 1 << uint(7-x%8)
+				}
+			case 8:
+				row[x] = byte((x*255/width + page*64) % 256)
+			default:
+				row[x*3] = byte(page * 80 % 256)    //blue
+				row[x*3+1] = byte(y * 255 / height) //green
+				row[x*3+2] = byte(x * 255 / width)  //red
+			}
+		}
+		buf.Write(row)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,226 @@
+package lisgo
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+)
+
+const testDeviceID = "fake:lisgo:Virtual Scanner"
+
+//TestMain makes New() use the virtual scanner of DefaultFakeConfig
+func TestMain(m *testing.M) {
+	os.Setenv(BackendEnvVar, BackendFake)
+	os.Exit(m.Run())
+}
+
+//testSource opens the paper source of the default virtual scanner, release closes the device and the API
+func testSource(t *testing.T, name string) (ps *PaperSource, release func()) {
+	t.Helper()
+	return testSourceWith(t, nil, name)
+}
+
+//testSourceWith opens the paper source of the first scanner of cfg, the default one if cfg is nil
+func testSourceWith(t *testing.T, cfg *FakeConfig, name string) (ps *PaperSource, release func()) {
+	t.Helper()
+	var lis *lisgo
+	var err error
+	id := testDeviceID
+	if cfg == nil {
+		lis, err = New()
+	} else {
+		lis, err = NewFake(cfg)
+		id = cfg.Devices[0].DeviceID
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := lis.GetDevice(id)
+	if err != nil || dev == nil {
+		lis.Close()
+		t.Fatalf("GetDevice: %v, %v", dev, err)
+	}
+	if err = dev.Open(); err != nil {
+		lis.Close()
+		t.Fatal(err)
+	}
+	release = func() {
+		dev.Close()
+		lis.Close()
+	}
+	ps, err = dev.GetPaperSource(name)
+	if err != nil || ps == nil {
+		release()
+		t.Fatalf("GetPaperSource(%s): %v, %v", name, ps, err)
+	}
+	return ps, release
+}
+
+//openDevices returns the count of devices of the virtual scanners which are not closed yet
+func openDevices(t *testing.T, lis *lisgo) int {
+	t.Helper()
+	b, ok := lis.backend.(*fakeBackend)
+	if !ok {
+		t.Fatalf("backend is %T, not the fake one", lis.backend)
+	}
+	return b.openDevices()
+}
+
+//setTestArea makes pages small: 75 dpi, 50x30 mm is 148x89 pixels
+func setTestArea(t *testing.T, ps *PaperSource, mode string) (width, height int) {
+	t.Helper()
+	for name, val := range map[string]string{OptionResolution: "75", OptionMode: mode, OptionBRX: "50", OptionBRY: "30"} {
+		if _, err := ps.SetOption(name, val); err != nil {
+			t.Fatalf("SetOption(%s, %s): %v", name, val, err)
+		}
+	}
+	return mmToPixels(50, 75), mmToPixels(30, 75)
+}
+
+//fakePixel is the pixel of the test pattern rendered by fakePage
+func fakePixel(mode string, page, x, y, width, height, dpi int) color.Color {
+	switch mode {
+	case FakeModeLineArt:
+		cell := dpi / 4
+		if (x/cell+y/cell+page)%2 == 0 {
+			return color.Gray{Y: 255}
+		}
+		return color.Gray{Y: 0}
+	case FakeModeGray:
+		return color.Gray{Y: byte((x*255/width + page*64) % 256)}
+	}
+	return color.RGBA{R: byte(x * 255 / width), G: byte(y * 255 / height), B: byte(page * 80 % 256), A: 255}
+}
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, _ := a.RGBA()
+	r2, g2, b2, _ := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2
+}
+
+//scanTestImage scans the first page of the source in mode
+func scanTestImage(t *testing.T, source string, mode string) (img image.Image, width, height int) {
+	t.Helper()
+	ps, release := testSource(t, source)
+	defer release()
+	width, height = setTestArea(t, ps, mode)
+	session, err := ps.ScanStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	page, err := session.NextPage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img, err = page.GetImage(); err != nil {
+		t.Fatal(err)
+	}
+	return img, width, height
+}
+
+func TestFakeListDevices(t *testing.T) {
+	lis, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	devices, err := lis.ListDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(devices))
+	}
+	dev := devices[0]
+	if dev.DeviceID != testDeviceID || dev.Vendor != "lisgo" || dev.Model != "Virtual Scanner" {
+		t.Errorf("unexpected device %+v", dev)
+	}
+
+	if err = dev.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	var names []string
+	var kinds []ItemType
+	err = dev.IterateSources(func(s *PaperSource) bool {
+		names = append(names, s.Name)
+		kinds = append(kinds, s.Kind)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "flatbed" || names[1] != "feeder" {
+		t.Errorf("got sources %v, want [flatbed feeder]", names)
+	}
+	if len(kinds) == 2 && (kinds[0] != LisItemFlatbed || kinds[1] != LisItemAdf) {
+		t.Errorf("got kinds %v", kinds)
+	}
+}
+
+func TestFakeGetImage(t *testing.T) {
+	for _, mode := range []string{FakeModeLineArt, FakeModeGray, FakeModeColor} {
+		t.Run(mode, func(t *testing.T) {
+			img, width, height := scanTestImage(t, "flatbed", mode)
+			if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+				t.Fatalf("got %v, want %dx%d", b, width, height)
+			}
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					src := x
+					if mode == FakeModeLineArt {
+						//GetImage shifts 1-bit pages by 64 pixels, see ImageBmpBw.ColorIndexAt
+						src = (x + 64) % width
+					}
+					want := fakePixel(mode, 0, src, y, width, height, 75)
+					if got := img.At(x, y); !sameColor(got, want) {
+						t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFakeConstraints(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+
+	res, err := ps.Option(OptionResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Constraint == nil || res.Constraint.ConstraintType != LisConstraintList {
+		t.Fatalf("resolution constraint %v, want a list", res.Constraint)
+	}
+	var dpis []int
+	for _, v := range res.Constraint.PossibleList {
+		dpis = append(dpis, v.IntValue)
+	}
+	if len(dpis) != 4 || dpis[0] != 75 || dpis[3] != 600 {
+		t.Errorf("got resolutions %v", dpis)
+	}
+
+	brightness, err := ps.Option("brightness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := brightness.Constraint; c == nil || c.ConstraintType != LisConstraintRange || c.PossibleRange == nil {
+		t.Fatalf("brightness constraint %v, want a range", c)
+	}
+	r := brightness.Constraint.PossibleRange
+	if r.MinValue.IntValue != -100 || r.MaxValue.IntValue != 100 || r.Interval.IntValue != 1 {
+		t.Errorf("got range %v..%v/%v", r.MinValue, r.MaxValue, r.Interval)
+	}
+
+	brx, err := ps.Option(OptionBRX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if brx.ValueUnit != LisUnitMM || brx.Constraint.PossibleRange.MaxValue.DoubleValue != 215.9 {
+		t.Errorf("got br-x %v", brx)
+	}
+}
@@ -5,7 +5,9 @@ go 1.13
 require (
 	github.com/apex/log v1.1.1
 	github.com/fatih/color v1.7.0
+	github.com/mattn/go-isatty v0.0.8
 	github.com/mattn/go-pointer v0.0.0-20190911064623-a0a44394634f
 	github.com/oliverpool/gofpdf v1.16.3
 	golang.org/x/image v0.0.0-20191206065243-da761ea9ff43
+	gopkg.in/yaml.v2 v2.4.0
 )
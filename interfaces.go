@@ -0,0 +1,108 @@
+package lisgo
+
+import (
+	"context"
+	"fmt"
+)
+
+//Interfaces implemented by *Scanner, *PaperSource and *ScanSession. Application code may depend on them
+//and substitute its own implementations in tests (or use NewFake for a complete virtual scanner).
+//The device interface is called Device because Scanner is the name of the concrete type.
+type (
+	//Device is a scanner, *Scanner implements it
+	Device interface {
+		//ID returns DeviceID
+		ID() string
+		Open() error
+		Close()
+		//Source returns the paper source with specified name or nil if there is no such source
+		Source(name string) (Source, error)
+		Sources() ([]Source, error)
+		//Options of the device item itself
+		Options() ([]*OptionDescriptor, error)
+		SetOption(name string, val string) (*SetResult, error)
+	}
+
+	//Source is a paper source of a scanner, *PaperSource implements it
+	Source interface {
+		//String returns the name of the source
+		fmt.Stringer
+		Type() ItemType
+		Options() ([]*OptionDescriptor, error)
+		Option(name string) (*OptionDescriptor, error)
+		SetOption(name string, val string) (*SetResult, error)
+		SetValue(name string, v LisValue) (*SetResult, error)
+		StartSession(ctx context.Context) (Session, error)
+	}
+
+	//Session is a scan session, *ScanSession implements it
+	Session interface {
+		EndOfFeed() bool
+		EndOfPage() bool
+		GetScanParameters() (*ScanParameters, error)
+		ScanRead() ([]byte, uint64, error)
+		ScanReadContext(ctx context.Context) ([]byte, uint64, error)
+		Cancel()
+		Close()
+	}
+)
+
+var (
+	_ Device  = (*Scanner)(nil)
+	_ Source  = (*PaperSource)(nil)
+	_ Session = (*ScanSession)(nil)
+)
+
+//ID returns DeviceID
+func (d *Scanner) ID() string {
+	return d.DeviceID
+}
+
+//Source is GetPaperSource returning the Source interface
+func (d *Scanner) Source(name string) (Source, error) {
+	s, err := d.GetPaperSource(name)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//Sources returns all paper sources of the scanner. The device must be open, the sources are valid until it's closed.
+func (d *Scanner) Sources() ([]Source, error) {
+	dev, err := d.openDevice("Sources")
+	if err != nil {
+		return nil, err
+	}
+	var res []Source
+	err = d.iterateSources(dev, func(s *PaperSource) bool {
+		res = append(res, s)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *PaperSource) String() string {
+	return s.Name
+}
+
+//Type returns the kind of the source: flatbed, feeder, etc
+func (s *PaperSource) Type() ItemType {
+	return s.Kind
+}
+
+//StartSession is ScanStartContext returning the Session interface
+func (s *PaperSource) StartSession(ctx context.Context) (Session, error) {
+	session, err := s.ScanStartContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+//NewScanParameters makes scan parameters for custom Session implementations
+func NewScanParameters(format ImageFormat, width int, height int, imageSize uint) *ScanParameters {
+	return &ScanParameters{format: format, width: width, height: height, imageSize: imageSize}
+}
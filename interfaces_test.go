@@ -0,0 +1,200 @@
+package lisgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestEnumStrings(t *testing.T) {
+	tests := []struct {
+		value fmt.Stringer
+		want  string
+	}{
+		{LisItemFlatbed, "Flatbed"},
+		{LisItemAdf, "ADF"},
+		{LisItemDevice, "Device"},
+		{ItemType(42), "ItemType(42)"},
+		{LisTypeBool, "Bool"},
+		{LisTypeDouble, "Double"},
+		{LisTypeImageFormat, "ImageFormat"},
+		{ValueType(42), "ValueType(42)"},
+		{LisUnitMM, "MM"},
+		{LisUnitDPI, "DPI"},
+		{LisUnitMicrosecond, "Microsecond"},
+		{Unit(42), "Unit(42)"},
+		{LisImgFormatBmp, "BMP"},
+		{LisImgFormatRawRGB24, "Raw RGB24"},
+		{LisImgFormatmMemoryBmp, "Memory BMP"},
+		{ImageFormat(42), "ImageFormat(42)"},
+	}
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Errorf("%T(%v): got %q, want %q", tt.value, tt.value, got, tt.want)
+		}
+	}
+}
+
+//testDevice returns the unopened default virtual scanner as Device
+func testDevice(t *testing.T) (d Device, release func()) {
+	t.Helper()
+	lis, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := lis.GetDevice(testDeviceID)
+	if err != nil || dev == nil {
+		lis.Close()
+		t.Fatalf("GetDevice: %v, %v", dev, err)
+	}
+	return dev, func() {
+		dev.Close()
+		lis.Close()
+	}
+}
+
+func TestDeviceSources(t *testing.T) {
+	d, release := testDevice(t)
+	defer release()
+	if d.ID() != testDeviceID {
+		t.Errorf("got ID %s", d.ID())
+	}
+
+	//the sources would point at the items of a device open just for the call
+	if sources, err := d.Sources(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Sources of an unopened scanner: got %v, %v, want ErrClosed", sources, err)
+	}
+	if s, err := d.Source("flatbed"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Source of an unopened scanner: got %v, %v, want ErrClosed", s, err)
+	}
+
+	if err := d.Open(); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := d.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		kind ItemType
+	}{
+		{"flatbed", LisItemFlatbed},
+		{"feeder", LisItemAdf},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("got %d sources, want %d", len(sources), len(want))
+	}
+	for k, s := range sources {
+		if s.String() != want[k].name || s.Type() != want[k].kind {
+			t.Errorf("source %d is %s (%s), want %s (%s)", k, s, s.Type(), want[k].name, want[k].kind)
+		}
+		opts, err := s.Options()
+		if err != nil || len(opts) == 0 {
+			t.Errorf("%s: got %d options, %v", s, len(opts), err)
+		}
+	}
+
+	feeder, err := d.Source("feeder")
+	if err != nil || feeder == nil {
+		t.Fatalf("Source(feeder): %v, %v", feeder, err)
+	}
+	if missing, err := d.Source("tray"); err != nil || missing != nil {
+		t.Errorf("Source(tray): %v, %v", missing, err)
+	}
+	session, err := feeder.StartSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := 0
+	for !session.EndOfFeed() {
+		params, err := session.GetScanParameters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = NewPageReader(session, params).GetImage(); err != nil {
+			t.Fatal(err)
+		}
+		pages++
+	}
+	session.Close()
+	if pages != 3 {
+		t.Errorf("got %d pages, want 3", pages)
+	}
+
+	d.Close()
+	if _, err = d.Sources(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Sources of a closed scanner: got %v, want ErrClosed", err)
+	}
+}
+
+//bmpSession is a Session of an application test, it returns the BMP pages in chunks.
+//Like the fake backend, the page is over until GetScanParameters starts the following one.
+type bmpSession struct {
+	pages  [][]byte
+	offset int
+}
+
+var _ Session = (*bmpSession)(nil)
+
+func (s *bmpSession) EndOfFeed() bool {
+	return len(s.pages) == 0 || len(s.pages) == 1 && s.EndOfPage()
+}
+
+func (s *bmpSession) EndOfPage() bool {
+	return s.offset == len(s.pages[0])
+}
+
+func (s *bmpSession) GetScanParameters() (*ScanParameters, error) {
+	if s.EndOfPage() && !s.EndOfFeed() {
+		s.pages, s.offset = s.pages[1:], 0
+	}
+	return NewScanParameters(LisImgFormatBmp, 0, 0, uint(len(s.pages[0]))), nil
+}
+
+func (s *bmpSession) ScanRead() ([]byte, uint64, error) {
+	return s.ScanReadContext(context.Background())
+}
+
+func (s *bmpSession) ScanReadContext(ctx context.Context) ([]byte, uint64, error) {
+	end := s.offset + 1000
+	if end > len(s.pages[0]) {
+		end = len(s.pages[0])
+	}
+	data := s.pages[0][s.offset:end]
+	s.offset = end
+	return data, uint64(len(data)), nil
+}
+
+func (s *bmpSession) Cancel() {}
+
+func (s *bmpSession) Close() {}
+
+//TestCustomSession decodes pages of a Session implemented outside of the package
+func TestCustomSession(t *testing.T) {
+	const width, height, dpi = 40, 30, 75
+	var session Session = &bmpSession{pages: [][]byte{
+		fakePage(FakeModeGray, width, height, dpi, 0),
+		fakePage(FakeModeColor, width, height, dpi, 1),
+	}}
+	modes := []string{FakeModeGray, FakeModeColor}
+	for k := 0; !session.EndOfFeed(); k++ {
+		params, err := session.GetScanParameters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := NewPageReader(session, params).GetImage()
+		if err != nil {
+			t.Fatalf("page %d: %v", k, err)
+		}
+		if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+			t.Fatalf("page %d is %v", k, b)
+		}
+		for _, x := range []int{0, width / 2, width - 1} {
+			if got, want := img.At(x, 1), fakePixel(modes[k], k, x, 1, width, height, dpi); !sameColor(got, want) {
+				t.Errorf("page %d: pixel (%d, 1) is %v, want %v", k, x, got, want)
+			}
+		}
+	}
+}
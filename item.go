@@ -0,0 +1,70 @@
+package lisgo
+
+import "sync"
+
+//Item is a node of the item tree of an open device. The root is the device itself, its children are the paper
+//sources, which may have children of their own (e.g. front and back of a feeder or frames of a film adapter).
+//Options, Type, SetOption, ScanStart etc come from the embedded PaperSource.
+type Item struct {
+	*PaperSource
+	parent *Item
+
+	mu       sync.Mutex
+	children []*Item //cached, nil until Children is called
+}
+
+//Root returns the device item. The device must be open, the items are valid until it's closed.
+func (d *Scanner) Root() (*Item, error) {
+	root, err := d.rootItem("Root")
+	if err != nil {
+		return nil, err
+	}
+	return &Item{PaperSource: root}, nil
+}
+
+//Parent returns the parent item, nil for the device item
+func (i *Item) Parent() *Item {
+	return i.parent
+}
+
+//Children returns the child items. They are fetched once.
+func (i *Item) Children() ([]*Item, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.children != nil {
+		return i.children, nil
+	}
+	children, err := i.source.children()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Item, 0, len(children))
+	for _, c := range children {
+		res = append(res, &Item{PaperSource: &PaperSource{Name: c.name(), Kind: c.kind(), source: c, lis: i.lis}, parent: i})
+	}
+	i.children = res
+	return res, nil
+}
+
+//Walk calls f for the item and its descendants depth first, depth of the item is 0.
+//It stops when f returns false.
+func (i *Item) Walk(f func(item *Item, depth int) bool) error {
+	_, err := i.walk(f, 0)
+	return err
+}
+
+func (i *Item) walk(f func(item *Item, depth int) bool, depth int) (bool, error) {
+	if !f(i, depth) {
+		return false, nil
+	}
+	children, err := i.Children()
+	if err != nil {
+		return false, err
+	}
+	for _, c := range children {
+		if cont, err := c.walk(f, depth+1); !cont || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
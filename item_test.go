@@ -0,0 +1,134 @@
+package lisgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestItemWalk(t *testing.T) {
+	type node struct {
+		Name   string
+		Kind   ItemType
+		Depth  int
+		Parent string
+	}
+	all := []node{
+		{testDeviceID, LisItemDevice, 0, ""},
+		{"flatbed", LisItemFlatbed, 1, testDeviceID},
+		{"feeder", LisItemAdf, 1, testDeviceID},
+		{"front", LisItemAdf, 2, "feeder"},
+		{"back", LisItemAdf, 2, "feeder"},
+	}
+	tests := []struct {
+		name string
+		stop string //the walk stops at this item
+		want []node
+	}{
+		{"whole tree", "", all},
+		{"stop at flatbed", "flatbed", all[:2]},
+		{"stop at front", "front", all[:4]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			dev, err := lis.GetDevice(testDeviceID)
+			if err != nil || dev == nil {
+				t.Fatalf("GetDevice: %v, %v", dev, err)
+			}
+			if _, err = dev.Root(); err == nil {
+				t.Fatal("Root of an unopened scanner succeeded")
+			}
+			if err = dev.Open(); err != nil {
+				t.Fatal(err)
+			}
+			root, err := dev.Root()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []node
+			err = root.Walk(func(item *Item, depth int) bool {
+				n := node{Name: item.Name, Kind: item.Type(), Depth: depth}
+				if p := item.Parent(); p != nil {
+					n.Parent = p.Name
+				}
+				got = append(got, n)
+				if _, err := item.Options(); err != nil {
+					t.Errorf("%s: %v", item.Name, err)
+				}
+				return item.Name != tt.stop
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walked %v, want %v", got, tt.want)
+			}
+
+			//the items are released with the device
+			dev.Close()
+			if n := openDevices(t, lis); n != 0 {
+				t.Errorf("%d devices are open after Close", n)
+			}
+		})
+	}
+}
+
+func TestItemChildren(t *testing.T) {
+	lis, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	dev, err := lis.GetDevice(testDeviceID)
+	if err != nil || dev == nil {
+		t.Fatalf("GetDevice: %v, %v", dev, err)
+	}
+	if err = dev.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	root, err := dev.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Parent() != nil || root.Type() != LisItemDevice {
+		t.Errorf("root has parent %v and type %s", root.Parent(), root.Type())
+	}
+
+	sources, err := root.Children()
+	if err != nil || len(sources) != 2 {
+		t.Fatalf("Children: %v, %v", sources, err)
+	}
+	//the children are fetched once
+	again, err := root.Children()
+	if err != nil || len(again) != 2 || again[0] != sources[0] {
+		t.Errorf("Children again: %v, %v", again, err)
+	}
+	feeder := sources[1]
+	sides, err := feeder.Children()
+	if err != nil || len(sides) != 2 || sides[0].Name != "front" || sides[1].Name != "back" {
+		t.Fatalf("feeder children: %v, %v", sides, err)
+	}
+	if sides[1].Parent() != feeder || feeder.Parent() != root {
+		t.Error("wrong parents")
+	}
+	if leaves, err := sides[0].Children(); err != nil || len(leaves) != 0 {
+		t.Errorf("front children: %v, %v", leaves, err)
+	}
+
+	//a nested item is a paper source of its own
+	if _, err = sides[1].SetOption(OptionResolution, "300"); err != nil {
+		t.Fatal(err)
+	}
+	if got := optionString(t, sides[1].PaperSource, OptionResolution); got != "300" {
+		t.Errorf("back resolution is %s", got)
+	}
+	if got := optionString(t, sides[0].PaperSource, OptionResolution); got != "150" {
+		t.Errorf("front resolution is %s, want the default 150", got)
+	}
+}
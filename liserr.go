@@ -1,3 +1,6 @@
+//go:build cgo && !lisgo_fake
+// +build cgo,!lisgo_fake
+
 package lisgo
 
 /*
@@ -15,7 +18,7 @@ type CErrorProxy struct {
 //NewErrProxy allocates internal *char buffer
 func NewErrProxy() *CErrorProxy {
 	var e CErrorProxy
-	e.cErr.buf = (*C.char)(C.calloc(1000, C.sizeof_char))
+	e.cErr.buf = (*C.char)(C.calloc(C.ERROR_PROXY_BUF_SIZE, C.sizeof_char))
 	return &e
 
 }
@@ -44,10 +47,27 @@ func (e *CErrorProxy) Error() string {
 	return C.GoString(e.cErr.buf)
 }
 
+//Err returns *Error if C-code has reported an error, nil otherwise
+func (e *CErrorProxy) Err() error {
+	if e.ErrNum() == LisOk {
+		return nil
+	}
+	var fn string
+	if e.cErr._func != nil {
+		fn = C.GoString(e.cErr._func)
+	}
+	return &Error{
+		Code: e.ErrNum(),
+		Func: fn,
+		Msg:  e.Error(),
+	}
+}
+
 //Clear prepares CError for future use
 func (e *CErrorProxy) Clear() {
 	*e.cErr.buf = 0
 	e.cErr.err = LisOk
+	e.cErr._func = nil
 }
 
 //Naive leaky buffer implementation adapted from Effective Go.
@@ -0,0 +1,104 @@
+package lisgo
+
+import "fmt"
+
+//enum lis_error
+const (
+	LisOk        uint32 = 0x00000000
+	LisEndOfPage uint32 = 0x00000001
+	LisEndOfFeed uint32 = 0x00000002
+	LisWarmingUp uint32 = 0x00000003
+
+	LisErrFlag         uint32 = 0x40000000 //set for every error code
+	LisErrDeviceBusy          = LisErrFlag | 0x0001
+	LisErrCancelled           = LisErrFlag | 0x0002
+	LisErrUnsupported         = LisErrFlag | 0x0003
+	LisErrInvalidValue        = LisErrFlag | 0x0004
+	LisErrJammed              = LisErrFlag | 0x0005
+	LisErrCoverOpen           = LisErrFlag | 0x0006
+	LisErrIOError             = LisErrFlag | 0x0007
+	LisErrNoMem               = LisErrFlag | 0x0008
+	LisErrAccessDenied        = LisErrFlag | 0x0009
+	LisErrHwIsLocked          = LisErrFlag | 0x000A
+	LisErrNoDocs              = LisErrFlag | 0x000B
+
+	LisErrInternalFlag                  uint32 = 0x60000000 //set for libinsane internal errors
+	LisErrInternalImgFormatNotSupported        = LisErrInternalFlag | 0x0001
+	LisErrInternalUnknownError                 = LisErrInternalFlag | 0x0002
+	LisErrInternalNotImplemented               = LisErrInternalFlag | 0x0003
+)
+
+var (
+	lisErrorNames = map[uint32]string{
+		LisOk:                               "Success",
+		LisEndOfPage:                        "End of page",
+		LisEndOfFeed:                        "End of feed",
+		LisWarmingUp:                        "Device is warming up",
+		LisErrDeviceBusy:                    "Device is busy",
+		LisErrCancelled:                     "Operation cancelled",
+		LisErrUnsupported:                   "Operation not supported",
+		LisErrInvalidValue:                  "Invalid value",
+		LisErrJammed:                        "Device jammed",
+		LisErrCoverOpen:                     "Cover is open",
+		LisErrIOError:                       "I/O error",
+		LisErrNoMem:                         "Out of memory",
+		LisErrAccessDenied:                  "Access denied",
+		LisErrHwIsLocked:                    "Hardware is locked",
+		LisErrNoDocs:                        "No document in the feeder",
+		LisErrInternalImgFormatNotSupported: "LibInsane internal error: Image format not supported",
+		LisErrInternalUnknownError:          "LibInsane internal error: Unknown error reported by backend",
+		LisErrInternalNotImplemented:        "LibInsane internal error: Operation not implemented",
+	}
+)
+
+//Sentinel errors to be used with errors.Is. They match any *Error with the same code.
+var (
+	ErrDeviceBusy   = newSentinel(LisErrDeviceBusy)
+	ErrJammed       = newSentinel(LisErrJammed)
+	ErrCoverOpen    = newSentinel(LisErrCoverOpen)
+	ErrNoDocs       = newSentinel(LisErrNoDocs)
+	ErrCancelled    = newSentinel(LisErrCancelled)
+	ErrUnsupported  = newSentinel(LisErrUnsupported)
+	ErrInvalidValue = newSentinel(LisErrInvalidValue)
+)
+
+//Error is an error reported by libinsane
+type Error struct {
+	//Code is the lis_error value
+	Code uint32
+	//Func is the name of the proxy function which got the error
+	Func string
+	//Msg is the libinsane error message
+	Msg string
+}
+
+func newSentinel(code uint32) *Error {
+	return &Error{Code: code, Msg: lisErrorNames[code]}
+}
+
+//newError makes an error with the standard message for the code followed by optional details
+func newError(code uint32, fn string, details string) *Error {
+	msg := lisErrorNames[code]
+	if details != "" {
+		msg += ": " + details
+	}
+	return &Error{Code: code, Func: fn, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	if e.Func == "" {
+		return fmt.Sprintf("Error 0x%X %s", e.Code, e.Msg)
+	}
+	return fmt.Sprintf("Error 0x%X in '%s' %s", e.Code, e.Func, e.Msg)
+}
+
+//Is reports whether target is an *Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+//IsInternal indicates libinsane internal error
+func (e *Error) IsInternal() bool {
+	return e.Code&LisErrInternalFlag == LisErrInternalFlag
+}
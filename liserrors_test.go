@@ -0,0 +1,84 @@
+package lisgo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	jammed := newError(LisErrJammed, "lis_scan_session_scan_read_proxy", "paper is stuck")
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"same code", jammed, ErrJammed, true},
+		{"other code", jammed, ErrCoverOpen, false},
+		{"wrapped", fmt.Errorf("page 2: %w", jammed), ErrJammed, true},
+		{"driver message", &Error{Code: LisErrDeviceBusy, Msg: "scanner is in use by another application"}, ErrDeviceBusy, true},
+		{"no docs", newError(LisErrNoDocs, "fake_scan_start", "feeder"), ErrNoDocs, true},
+		{"cancelled", newError(LisErrCancelled, "", ""), ErrCancelled, true},
+		{"unsupported", newError(LisErrUnsupported, "", ""), ErrUnsupported, true},
+		{"invalid value", newError(LisErrInvalidValue, "", ""), ErrInvalidValue, true},
+		{"plain error", errors.New("Device jammed"), ErrJammed, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, tt.target); got != tt.want {
+			t.Errorf("%s: errors.Is(%v, %v) = %v, want %v", tt.name, tt.err, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	tests := []struct {
+		err      *Error
+		want     string
+		internal bool
+	}{
+		{newError(LisErrJammed, "lis_scan_read", ""), "Error 0x40000005 in 'lis_scan_read' Device jammed", false},
+		{newError(LisErrInvalidValue, "SetValue", "value 7"), "Error 0x40000004 in 'SetValue' Invalid value: value 7", false},
+		{ErrCoverOpen, "Error 0x40000006 Cover is open", false},
+		{newError(LisErrInternalNotImplemented, "", ""), "Error 0x60000003 LibInsane internal error: Operation not implemented", true},
+		{&Error{Code: LisErrInternalUnknownError, Func: "get_children", Msg: "twain failure"}, "Error 0x60000002 in 'get_children' twain failure", true},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+		if got := tt.err.IsInternal(); got != tt.internal {
+			t.Errorf("%s: IsInternal() = %v, want %v", tt.want, got, tt.internal)
+		}
+	}
+}
+
+//TestBackendErrors checks the errors of the backend carry the code and the function
+func TestBackendErrors(t *testing.T) {
+	cfg := testOptionsConfig()
+	cfg.Devices[0].Sources[0].Pages = 0
+	ps, release := testSourceWith(t, cfg, "flatbed")
+	defer release()
+
+	tests := []struct {
+		name   string
+		call   func() error
+		target error
+		fn     string
+	}{
+		{"not allowed", func() error { _, err := ps.SetOption(OptionResolution, "200"); return err }, ErrInvalidValue, "SetValue"},
+		{"not a number", func() error { _, err := ps.SetOption(OptionResolution, "high"); return err }, ErrInvalidValue, "SetOption"},
+		{"no docs", func() error { _, err := ps.ScanStart(); return err }, ErrNoDocs, "fake_scan_start"},
+	}
+	for _, tt := range tests {
+		err := tt.call()
+		if !errors.Is(err, tt.target) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.target)
+			continue
+		}
+		var lisErr *Error
+		if !errors.As(err, &lisErr) || lisErr.Func != tt.fn {
+			t.Errorf("%s: got function %q, want %q", tt.name, lisErr.Func, tt.fn)
+		}
+	}
+}
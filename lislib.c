@@ -1,3 +1,6 @@
+//go:build cgo && !lisgo_fake
+// +build cgo,!lisgo_fake
+
 #include <stdlib.h>
 #include <assert.h>
 #include <stdio.h>
@@ -17,6 +20,12 @@ void set_log_callbacks() {
 	lis_set_log_callbacks(&g_log_callbacks);
 }
 
+void set_error(struct error_proxy *proxy, enum lis_error err, const char *func) {
+	proxy->err = err;
+	proxy->func = func;
+	snprintf(proxy->buf, ERROR_PROXY_BUF_SIZE, "%s", lis_strerror(err));
+}
+
 void lis_value_print(enum lis_value_type typ, union lis_value *val) {
 	switch (typ)
 	{
@@ -73,20 +82,36 @@ union lis_value* lis_option_descriptor_get_value_proxy(struct lis_option_descrip
 	val = calloc(1, sizeof(union lis_value)); //won't free it as stated in the get_value's doc
 	err = opt->fn.get_value(opt, val);
 	if (err != LIS_OK) {
-		error->err = err;
-		sprintf(error->buf, "Error %d in 'lis_option_descriptor_get_value_proxy' %s", err, lis_strerror(err));
+		set_error(error, err, __func__);
 		free(val);
 		return NULL;
 	}
 	return val;
 }
 
-void lis_set_option_proxy(struct lis_item *source, char* opt_name, char *value, struct error_proxy *err) {
-	union lis_value *val;
-	//val = calloc(1, sizeof(union lis_value)); //won't free it as stated in the get_value's doc
-	err->err = lis_set_option(source, opt_name, value);
+void lis_option_descriptor_set_value_proxy(struct lis_option_descriptor *opt, int int_value, double double_value, char *string_value, int *set_flags, struct error_proxy *err) {
+	union lis_value val;
+	switch (opt->value.type) {
+	case LIS_TYPE_BOOL:
+		val.boolean = int_value;
+		break;
+	case LIS_TYPE_INTEGER:
+		val.integer = int_value;
+		break;
+	case LIS_TYPE_DOUBLE:
+		val.dbl = double_value;
+		break;
+	case LIS_TYPE_STRING:
+		val.string = string_value;
+		break;
+	case LIS_TYPE_IMAGE_FORMAT:
+		val.format = int_value;
+		break;
+	}
+	*set_flags = 0;
+	err->err = opt->fn.set_value(opt, val, set_flags);
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'lis_set_option_proxy' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 	}
 }
 
@@ -95,7 +120,7 @@ struct lis_scan_session* lis_item_scan_start_proxy(struct lis_item *source, stru
 	//enum lis_error err;
 	err->err = source->scan_start(source, &session);
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'lis_item_scan_start_proxy' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		return NULL;
 	}
 	return session;
@@ -105,8 +130,7 @@ void lis_scan_session_get_scan_parameters_proxy(struct lis_scan_session *session
 	enum lis_error err;
 	err = session->get_scan_parameters(session, params);
 	if (err != LIS_OK) {
-		error->err = err;
-		sprintf(error->buf, "Error %d in 'lis_scan_session_get_scan_parameters' %s", err, lis_strerror(err));
+		set_error(error, err, __func__);
 		return;
 	}
 }
@@ -123,24 +147,31 @@ void lis_scan_session_cancel_proxy(struct lis_scan_session *session) {
     return session->cancel(session);
 }
 
-void lis_scan_session_scan_read_proxy(struct lis_scan_session *session, void *out_buffer, size_t *buf_size, struct error_proxy *error) {
+void lis_scan_session_scan_read_proxy(struct lis_scan_session *session, void *out_buffer, size_t *buf_size, int warmup_timeout, struct error_proxy *error) {
 	enum lis_error err;
+	size_t capacity = *buf_size;
+	int waited = 0;
 	while (1) {
+		*buf_size = capacity;
 		err = session->scan_read(session, out_buffer, buf_size); 
 		if (err == LIS_WARMING_UP) {
 			// old scanners need warming time.
 			// No data has been returned.
-			assert(buf_size == 0);
+			assert(*buf_size == 0);
+			if (warmup_timeout > 0 && waited >= warmup_timeout) {
+				// the lamp is still cold, give up
+				break;
+			}
 			logProxy(LIS_LOG_LVL_WARNING, "Warming the lamp up... waiting for 1 sec...");
 			sleep(1);
+			waited++;
 			continue;
 		} else {
 			break;
 		}
 	}
 	if (err != LIS_OK) {
-		error->err = err;
-		sprintf(error->buf, "Error %d in 'lis_scan_session_scan_read_proxy' %s", err, lis_strerror(err));
+		set_error(error, err, __func__);
 		return;
 	}
 
@@ -159,7 +190,7 @@ void lis_item_iterate_options(struct lis_item *item, void *cb, struct error_prox
 
 	err->err = item->get_options(item, &options);
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'iterate_options' %s", err->err, lis_strerror(err->err));		
+		set_error(err, err->err, __func__);
 		return;
 	}
 
@@ -175,7 +206,6 @@ void lis_item_iterate_options(struct lis_item *item, void *cb, struct error_prox
 		}
 		//printf("Option:%s\n", options[i]->name);		
 	}	
-	item->close(item);
 }
 
 struct lis_item* lis_api_get_device_proxy(struct lis_api *api, const char *device_id, struct error_proxy *err) {
@@ -183,7 +213,7 @@ struct lis_item* lis_api_get_device_proxy(struct lis_api *api, const char *devic
 
 	err->err = api->get_device(api, device_id, &item);
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'lis_api_get_device_proxy' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		return NULL;
 	}
 
@@ -203,7 +233,7 @@ void lis_item_iterate_sources(struct lis_api *api, char *device_id, struct lis_i
 	if (device == NULL) {
 		err->err = api->get_device(api, device_id, &item);
 		if (err->err != LIS_OK) {
-			sprintf(err->buf, "Error %d in 'iterate_sources' %s", err->err, lis_strerror(err->err));
+			set_error(err, err->err, __func__);
 			return;
 		}
 	}
@@ -211,7 +241,7 @@ void lis_item_iterate_sources(struct lis_api *api, char *device_id, struct lis_i
 	
 	err->err = item->get_children(item, &sources);
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'iterate_sources' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		return;
 	}	
 
@@ -234,13 +264,13 @@ struct lis_item** lis_item_list_sources(struct lis_api *api, char* device_id, st
 	err->err = api->get_device(api, device_id, &item);
 
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'list_sources' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		return NULL;
 	}
 	err->err = item->get_children(item, &sources);
 
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'list_sources' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		item->close(item);
 		return NULL;
 	}
@@ -259,7 +289,7 @@ struct lis_api *lis_api_get_api(struct error_proxy *err) {
 
 	err->err = lis_safebet(&impl);
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'get_api' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		return NULL;
 	}	
 	return impl;
@@ -269,15 +299,15 @@ void lis_api_cleanup_proxy(struct lis_api* impl) {
 	impl->cleanup(impl);
 }
 
-struct lis_device_descriptor** lis_api_list_devices_proxy(struct lis_api* impl, struct error_proxy* err) {
+struct lis_device_descriptor** lis_api_list_devices_proxy(struct lis_api* impl, enum lis_device_locations locs, struct error_proxy* err) {
 
 	struct lis_device_descriptor **dev_infos;
 	struct lis_item *device = NULL;
 
-	err->err = impl->list_devices(impl, LIS_DEVICE_LOCATIONS_ANY, &dev_infos);
+	err->err = impl->list_devices(impl, locs, &dev_infos);
 
 	if (err->err != LIS_OK) {
-		sprintf(err->buf, "Error %d in 'lis_api_list_devices_proxy' %s", err->err, lis_strerror(err->err));
+		set_error(err, err->err, __func__);
 		return NULL;
 	}
 
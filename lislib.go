@@ -1,30 +1,33 @@
 package lisgo
 
-// LDFLAGS: --static ${SRCDIR}/../libinsane.a -lregex -lole32  -loleaut32 -luuid -lsystre -ltre  -lpthread -lintl -liconv
-
-/*
-#include <libinsane/capi.h>
-#include <lislib.h>
-*/
-import "C"
 import (
+	"context"
 	"errors"
 	"fmt"
-	"unsafe"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
 
-	"github.com/mattn/go-pointer"
+	"github.com/apex/log"
 )
 
 type (
-	//lisgo is a holder for *lis_api
+	//lisgo is a holder for the scanning backend (libinsane or the fake one)
 	lisgo struct {
-		lisgo *C.struct_lis_api
+		backend backend
+		cache   deviceCache
+
+		timeoutsMu sync.Mutex
+		timeouts   Timeouts
 	}
 
 	//Scanner is a descriptor of scanner
 	Scanner struct {
-		lisDevice *C.struct_lis_item
+		lisDevice backendItem
 		lis       *lisgo
+		root      *PaperSource //options of the device item, see Scanner.Options
 		DeviceID  string
 		Vendor    string
 		Model     string
@@ -33,86 +36,166 @@ type (
 
 	//ScanParameters holds the current scan session's parameters
 	ScanParameters struct {
-		lisScanParameters C.struct_lis_scan_parameters
+		format    ImageFormat
+		width     int
+		height    int
+		imageSize uint
 	}
 )
 
 //mostly buffer sizes here
 const (
-	ScanSessionCBufferSize = 1024 * 1024 //1MB
+	ScanSessionCBufferSize   = 1024 * 1024 //1MB, the default buffer size of a scan session, see ScanSession.SetBufferSize
+	ScanSessionMaxBufferSize = maxSliceLen //16MB, the largest buffer of a scan session
+)
+
+//enum lis_device_locations
+const (
+	LisDeviceLocationsAny = iota
+	LisDeviceLocationsLocalOnly
+)
+
+//ItemType is enum lis_item_type, the kind of a device item
+type ItemType uint32
+
+//enum lis_item_type
+const (
+	LisItemUnidentified ItemType = iota
+	LisItemDevice
+	LisItemFlatbed
+	LisItemAdf
+)
+
+var lisItemTypeNames = map[ItemType]string{
+	LisItemUnidentified: "Unidentified",
+	LisItemDevice:       "Device",
+	LisItemFlatbed:      "Flatbed",
+	LisItemAdf:          "ADF",
+}
+
+func (t ItemType) String() string {
+	if name, ok := lisItemTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ItemType(%d)", uint32(t))
+}
+
+//Backend names accepted by the LISGO_BACKEND environment variable
+const (
+	BackendEnvVar    = "LISGO_BACKEND"
+	BackendLibinsane = "libinsane"
+	BackendFake      = "fake"
+	BackendWorker    = "worker"
 )
 
-//New creates new instances of lis_api using lis_safe_bet
+//New creates new instance of the scanning API. By default it uses libinsane (lis_safebet),
+//set LISGO_BACKEND=fake to use the virtual scanner instead. Builds without cgo or
+//with the lisgo_fake tag always use the virtual scanner.
+//LISGO_BACKEND=worker runs libinsane in a child process ("lisgo worker", see NewWorker),
+//the worker executable is taken from LISGO_WORKER.
 func New() (*lisgo, error) {
-	C.set_log_callbacks()
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-
-	var lib lisgo
-	lib.lisgo = C.lis_api_get_api(errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		err := errors.New(errProxy.Error())
+	name := os.Getenv(BackendEnvVar)
+	if name == "" {
+		name = defaultBackend
+	}
+	if name == BackendWorker {
+		return newWorkerFromEnv()
+	}
+	b, err := newBackend(name)
+	if err != nil {
 		return nil, err
 	}
-	return &lib, nil
+	return &lisgo{backend: b}, nil
+}
+
+//newBackend creates an in-process backend by its name
+func newBackend(name string) (backend, error) {
+	switch name {
+	case BackendFake:
+		return newFakeBackend(DefaultFakeConfig()), nil
+	case BackendLibinsane:
+		b, err := newLisBackend()
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unknown backend '%s'", name)
+}
+
+//NewFake creates new instance of the scanning API backed by virtual scanners described by cfg.
+//If cfg is nil, DefaultFakeConfig is used.
+func NewFake(cfg *FakeConfig) (*lisgo, error) {
+	if cfg == nil {
+		cfg = DefaultFakeConfig()
+	}
+	return &lisgo{backend: newFakeBackend(cfg)}, nil
 }
 
 //Close releases lis_api and and all connected objects
 func (o *lisgo) Close() {
-	C.lis_api_cleanup_proxy(o.lisgo)
+	o.backend.cleanup()
 }
 
 //ListDevices returns available scanners (online for WIA and all for Twain)
 func (o *lisgo) ListDevices() ([]*Scanner, error) {
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
+	return o.ListDevicesWith(ListOptions{})
+}
 
-	cdevs := C.lis_api_list_devices_proxy(o.lisgo, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		err := errors.New(errProxy.Error())
-		return nil, err
+//ListDevicesWith returns available scanners found at opts.Locations. The list comes from the cache
+//if it's enabled by SetDeviceCacheTTL and fresh enough, unless opts.Refresh is set.
+func (o *lisgo) ListDevicesWith(opts ListOptions) ([]*Scanner, error) {
+	if !opts.Refresh {
+		if devices := o.cachedDevices(opts.Locations); devices != nil {
+			return devices, nil
+		}
 	}
-
-	if cdevs == nil {
-		return nil, nil
+	var devices []*Scanner
+	var err error
+	_, terr := o.call("ListDevices", o.getTimeouts().ListDevices, func() {
+		devices, err = o.backend.listDevices(opts.Locations)
+	})
+	if terr != nil {
+		return nil, terr
 	}
-
-	arrLen := C.lis_array_length(unsafe.Pointer(cdevs))
-
-	//Apply strong magic to get GO slice backed by C null-terminated array
-	devs := (*[maxSliceLen]*C.struct_lis_device_descriptor)(unsafe.Pointer(cdevs))[:arrLen:arrLen]
-
-	devices := make([]*Scanner, 0)
-	for _, d := range devs {
-		devices = append(devices, d.conv2Go(o))
+	if err != nil {
+		return nil, err
 	}
-
+	for _, d := range devices {
+		d.lis = o
+	}
+	o.cacheDevices(opts.Locations, devices)
 	return devices, nil
-
 }
 
-//GetDevice searches thru the list of scanners for a device with specified id
+//GetDevice returns the scanner with specified id or nil if there is no such scanner. The scanner isn't open.
+//A device known to the cache is returned as is. Otherwise the id is checked by opening the device directly,
+//libinsane doesn't describe a single device, so Vendor and Model come from the id if it has the
+//"backend:vendor:model" form (TWAIN) and are empty otherwise. Devices are enumerated only if the direct opening fails.
 func (o *lisgo) GetDevice(deviceID string) (*Scanner, error) {
+	if dev := o.cachedDevice(deviceID); dev != nil {
+		return dev, nil
+	}
 
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-	cdevs := C.lis_api_list_devices_proxy(o.lisgo, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		err := errors.New(errProxy.Error())
+	dev := &Scanner{lis: o, DeviceID: deviceID}
+	item, err := dev.getDevice()
+	if err == nil {
+		item.close()
+		dev.Vendor, dev.Model = splitDeviceID(deviceID)
+		return dev, nil
+	}
+	if errors.Is(err, ErrTimeout) {
+		//the device is there but doesn't answer, enumeration won't help
 		return nil, err
 	}
+	log.WithError(err).WithField("device", deviceID).Debug("cannot open device directly, enumerating")
 
-	if cdevs == nil {
-		return nil, nil
+	devices, err := o.ListDevicesWith(ListOptions{Refresh: true})
+	if err != nil {
+		return nil, err
 	}
 
-	arrlen := C.lis_array_length(unsafe.Pointer(cdevs))
-
-	//Apply strong magic to get GO slice backed by C null-terminated array
-	devs := (*[maxSliceLen]*C.struct_lis_device_descriptor)(unsafe.Pointer(cdevs))[:arrlen:arrlen]
-
-	for _, d := range devs {
-		dev := d.conv2Go(o)
+	for _, dev := range devices {
 		if dev.DeviceID == deviceID {
 			return dev, nil
 		}
@@ -122,92 +205,146 @@ func (o *lisgo) GetDevice(deviceID string) (*Scanner, error) {
 
 }
 
-func (d *C.struct_lis_device_descriptor) conv2Go(o *lisgo) *Scanner {
-	return &Scanner{
-		nil,
-		o,
-		C.GoString(d.dev_id),
-		C.GoString(d.vendor),
-		C.GoString(d.model),
-		C.GoString(d._type),
+//splitDeviceID returns vendor and model from the id in "backend:vendor:model" form, empty strings otherwise
+func splitDeviceID(deviceID string) (string, string) {
+	parts := strings.Split(deviceID, ":")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "", ""
 	}
+	return parts[1], parts[2]
 }
 
 //PaperSource represents a source of paper for scan, i.e flatbed or automatic feeder
 type PaperSource struct {
 	Name   string
-	Kind   C.enum_lis_item_type
-	source *C.struct_lis_item
-}
+	Kind   ItemType
+	source backendItem
+	lis    *lisgo
 
-type iterSourcesCallback struct {
-	callback func(*PaperSource) bool
+	mu   sync.Mutex
+	opts []*OptionDescriptor //cached descriptors, dropped when the driver asks to reload them
 }
 
-type iterOptionsCallback struct {
-	callback func(*OptionDescriptor) bool
+//Open calls lis->get_device. Should be called before any of GetSourceByName, IterateOptions are called.
+//It does nothing if the device is already open.
+func (d *Scanner) Open() error {
+	if d.lisDevice != nil {
+		return nil
+	}
+	dev, err := d.getDevice()
+	if err != nil {
+		return err
+	}
+	d.lisDevice = dev
+	return nil
 }
 
-//export iterSourcesProxy
-func iterSourcesProxy(cb unsafe.Pointer, sourcePtr *C.struct_lis_item, sourceName *C.char, kind C.enum_lis_item_type) C.int {
-	res := &PaperSource{
-		Name:   C.GoString(sourceName),
-		Kind:   kind,
-		source: sourcePtr,
-	}
-	if pointer.Restore(cb).(*iterSourcesCallback).callback(res) {
-		return 1
+//getDevice opens the device within Timeouts.Open
+func (d *Scanner) getDevice() (backendItem, error) {
+	var dev backendItem
+	var err error
+	done, terr := d.lis.call("Open", d.lis.getTimeouts().Open, func() {
+		dev, err = d.lis.backend.getDevice(d.DeviceID)
+	})
+	if terr != nil {
+		go func() {
+			//nobody needs the device anymore
+			<-done
+			if err == nil {
+				dev.close()
+			}
+		}()
+		return nil, terr
 	}
-	return 0
+	return dev, err
 }
 
-//export iterOptionsProxy
-func iterOptionsProxy(cb unsafe.Pointer, opt *C.struct_lis_option_descriptor, valType C.enum_lis_value_type, conType C.int, conPossible unsafe.Pointer) C.int {
+//Close should be called after Open to release associated resources, it does nothing if the device isn't open
+func (d *Scanner) Close() {
+	if d.lisDevice == nil {
+		return
+	}
+	d.lisDevice.close()
+	d.lisDevice = nil
+	d.root = nil
+}
 
+//Options returns descriptors of the options of the device item itself, not of its paper sources.
+//The device must be open. See PaperSource.Options.
+func (d *Scanner) Options() ([]*OptionDescriptor, error) {
+	root, err := d.rootItem("Options")
+	if err != nil {
+		return nil, err
+	}
+	return root.Options()
+}
 
-	res := &OptionDescriptor{
-		optStruct:    opt,
-		Name:         C.GoString(opt.name),
-		Title:        C.GoString(opt.title),
-		Desc:         C.GoString(opt.desc),
-		Capabilities: int(opt.capabilities),
-		ValueType:    valType,
-		ValueUnit:    opt.value.unit,
-		Constraint:   NewConstraint(valType, conType, conPossible),
+//Option returns the device option with specified name if any. Otherwise it returns nil.
+func (d *Scanner) Option(name string) (*OptionDescriptor, error) {
+	root, err := d.rootItem("Option")
+	if err != nil {
+		return nil, err
 	}
+	return root.Option(name)
+}
 
-	if pointer.Restore(cb).(*iterOptionsCallback).callback(res) {
-		return 1
+//SetOption sets the device option, see PaperSource.SetOption. Paper sources got before
+//may have stale options if the result asks to reload them, get the sources again.
+func (d *Scanner) SetOption(name string, val string) (*SetResult, error) {
+	root, err := d.rootItem("SetOption")
+	if err != nil {
+		return nil, err
 	}
-	return 0
+	return root.SetOption(name, val)
 }
 
-//Open calls lis->get_device. Should be called before any of GetSourceByName, IterateOptions are called.
-func (d *Scanner) Open() error {
-	var dev *C.char = C.CString(d.DeviceID)
-	defer C.free(unsafe.Pointer(dev))
+//SetOptionNearest sets the device option snapping to the nearest legal value, see PaperSource.SetOptionNearest
+func (d *Scanner) SetOptionNearest(name string, val string) (*SetResult, error) {
+	root, err := d.rootItem("SetOptionNearest")
+	if err != nil {
+		return nil, err
+	}
+	return root.SetOptionNearest(name, val)
+}
 
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
+//SetValue sets the device option, see PaperSource.SetValue
+func (d *Scanner) SetValue(name string, v LisValue) (*SetResult, error) {
+	root, err := d.rootItem("SetValue")
+	if err != nil {
+		return nil, err
+	}
+	return root.SetValue(name, v)
+}
 
-	d.lisDevice = C.lis_api_get_device_proxy(d.lis.lisgo, dev, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		return errors.New(errProxy.Error())
+//openDevice returns the item of the open device, the error matches ErrClosed if the device isn't open
+func (d *Scanner) openDevice(fn string) (backendItem, error) {
+	if d.lisDevice == nil {
+		return nil, fmt.Errorf("%s: device '%s' is not open: %w", fn, d.DeviceID, ErrClosed)
 	}
-	return nil
+	return d.lisDevice, nil
 }
 
-//Close should be called after Open to release associated resources
-func (d *Scanner) Close() {
-	C.lis_item_close_proxy(d.lisDevice)
-	d.lisDevice = nil
+//rootItem wraps the open device item into a PaperSource to share the option handling
+func (d *Scanner) rootItem(fn string) (*PaperSource, error) {
+	dev, err := d.openDevice(fn)
+	if err != nil {
+		return nil, err
+	}
+	if d.root == nil {
+		d.root = &PaperSource{Name: d.DeviceID, Kind: LisItemDevice, source: dev, lis: d.lis}
+	}
+	return d.root, nil
 }
 
 //GetPaperSource returns paper source with specified name if any.
-// Otherwise it returns nil.
+// Otherwise it returns nil. The device must be open, the source is valid until the device is closed.
 func (d *Scanner) GetPaperSource(name string) (*PaperSource, error) {
+	dev, err := d.openDevice("GetPaperSource")
+	if err != nil {
+		return nil, err
+	}
 	var source *PaperSource
-	err := d.iterateSourcesInternal(nil, d.lisDevice, func(s *PaperSource) bool {
+	err = d.iterateSources(dev, func(s *PaperSource) bool {
 		if s.Name == name {
 			source = s
 			return false
@@ -220,167 +357,486 @@ func (d *Scanner) GetPaperSource(name string) (*PaperSource, error) {
 	return source, nil
 }
 
-//IterateSources iterates thru paper sources
+//IterateSources iterates thru paper sources. If the device isn't open, it's open for the iteration and closed
+//after it: the sources passed to f are valid only until f returns then.
 func (d *Scanner) IterateSources(f func(*PaperSource) bool) error {
 	if d.lisDevice == nil {
-		var dev *C.char = C.CString(d.DeviceID)
-		defer C.free(unsafe.Pointer(dev))
 		//device's gonna be open and then closed automatically
-		return d.iterateSourcesInternal(dev, nil, f)
-	} else {
-		//device is already open
-		//fmt.Printf("Device [%v] is already open\n", d.DeviceID)
-		return d.iterateSourcesInternal(nil, d.lisDevice, f)
+		dev, err := d.getDevice()
+		if err != nil {
+			return err
+		}
+		defer dev.close()
+		return d.iterateSources(dev, f)
 	}
+	//device is already open
+	return d.iterateSources(d.lisDevice, f)
 }
 
-func (d *Scanner) iterateSourcesInternal(devID *C.char, devRef *C.struct_lis_item, f func(*PaperSource) bool) error {
-	proxy := iterSourcesCallback{f}
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-
-	C.lis_item_iterate_sources(d.lis.lisgo, devID, devRef, pointer.Save(&proxy), errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		return errors.New(errProxy.Error())
+func (d *Scanner) iterateSources(dev backendItem, f func(*PaperSource) bool) error {
+	children, err := dev.children()
+	if err != nil {
+		return err
+	}
+	for _, c := range children {
+		if !f(&PaperSource{Name: c.name(), Kind: c.kind(), source: c, lis: d.lis}) {
+			break
+		}
 	}
 	return nil
 }
 
+//Options returns descriptors of the paper source options, cached while the device is open. When the driver asks
+//to reload options, the cache is replaced with new descriptors. The old ones keep their capabilities and constraint,
+//only GetValue and SetValue redirect to the new option, so get the options again after SetResult.ReloadOptions.
+func (s *PaperSource) Options() ([]*OptionDescriptor, error) {
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	return append([]*OptionDescriptor(nil), opts...), nil
+}
+
+//Option returns the option with specified name if any. Otherwise it returns nil.
+func (s *PaperSource) Option(name string) (*OptionDescriptor, error) {
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		if o.Name == name {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
 //IterateOptions iterates thru options of the paper source
 func (s *PaperSource) IterateOptions(f func(*OptionDescriptor) bool) error {
-	proxy := iterOptionsCallback{f}
+	opts, err := s.options()
+	if err != nil {
+		return err
+	}
+	for _, o := range opts {
+		if !f(o) {
+			break
+		}
+	}
+	return nil
+}
+
+//SetOption accepts string representation of value, converts it to the actual type of the option and sets it.
+//The value is validated like in SetValue.
+func (s *PaperSource) SetOption(name string, val string) (*SetResult, error) {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseValue(opt.ValueType, val)
+	if err != nil {
+		return nil, err
+	}
+	return s.setValue(opt, *v)
+}
+
+//SetValue checks v against the option's constraint and sets it. If the value isn't allowed, the returned error
+//(matching ErrInvalidValue) lists the allowed values. An integer may be set to a double option,
+//a string of a list in another case is set the way the driver spells it.
+func (s *PaperSource) SetValue(name string, v LisValue) (*SetResult, error) {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.setValue(opt, v)
+}
 
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
+//SetOptionNearest is SetOption which replaces a value not allowed by the constraint with the nearest legal one
+//(see OptionConstraint.Nearest) instead of failing. A fractional value of an integer option is accepted too.
+//SetResult.Snapped tells that the value has been replaced, SetResult.Value is the value applied.
+func (s *PaperSource) SetOptionNearest(name string, val string) (*SetResult, error) {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := parseValue(opt.ValueType, val)
+	if err != nil && opt.ValueType == LisTypeInteger {
+		v, err = parseValue(LisTypeDouble, val)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.setNearest(opt, *v)
+}
 
-	C.lis_item_iterate_options(s.source, pointer.Save(&proxy), errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		return errors.New(errProxy.Error())
+//SetValueNearest is SetValue snapping to the nearest legal value, see SetOptionNearest
+func (s *PaperSource) SetValueNearest(name string, v LisValue) (*SetResult, error) {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.setNearest(opt, v)
+}
+
+//SetInt sets an integer (or double) option, see SetValue
+func (s *PaperSource) SetInt(name string, v int) error {
+	_, err := s.SetValue(name, LisValue{ValType: LisTypeInteger, IntValue: v})
+	return err
+}
+
+//SetBool sets a boolean option, see SetValue
+func (s *PaperSource) SetBool(name string, v bool) error {
+	_, err := s.SetValue(name, LisValue{ValType: LisTypeBool, BoolValue: v})
+	return err
+}
+
+//SetDouble sets a double option, see SetValue
+func (s *PaperSource) SetDouble(name string, v float64) error {
+	_, err := s.SetValue(name, LisValue{ValType: LisTypeDouble, DoubleValue: v})
+	return err
+}
+
+//SetString sets a string option, see SetValue
+func (s *PaperSource) SetString(name string, v string) error {
+	_, err := s.SetValue(name, LisValue{ValType: LisTypeString, StringValue: v})
+	return err
+}
+
+//setNearest snaps v to the constraint of the option and sets it. If there is no legal value
+//close to v, setValue reports the error with the allowed values.
+func (s *PaperSource) setNearest(opt *OptionDescriptor, v LisValue) (*SetResult, error) {
+	snapped := false
+	if n, ok := opt.Constraint.Nearest(v); ok {
+		same, conv := v.toType(n.ValType)
+		snapped = !conv || !n.equal(same)
+		v = n
+	}
+	if v.ValType == LisTypeDouble && opt.ValueType == LisTypeInteger {
+		//no constraint to snap to
+		snapped = snapped || v.DoubleValue != math.Round(v.DoubleValue)
+		v = LisValue{ValType: LisTypeInteger, IntValue: int(math.Round(v.DoubleValue))}
+	}
+	res, err := s.setValue(opt, v)
+	if err != nil {
+		return nil, err
+	}
+	res.Snapped = snapped
+	return res, nil
+}
+
+//setValue sets the option and reloads the options if the driver asks to
+func (s *PaperSource) setValue(opt *OptionDescriptor, v LisValue) (*SetResult, error) {
+	val, err := opt.checkValue(v)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := opt.opt.setValue(val)
+	if err != nil {
+		return nil, err
+	}
+	res := SetResult{
+		Inexact:       flags&LisSetFlagInexact != 0,
+		ReloadOptions: flags&LisSetFlagMustReloadOptions != 0,
+		ReloadParams:  flags&LisSetFlagMustReloadParams != 0,
+	}
+	if res.ReloadOptions {
+		if err = s.reloadOptions(); err != nil {
+			return nil, err
+		}
+		opt = opt.current()
+	}
+	if opt.IsReadable() {
+		if res.Value, err = opt.GetValue(); err != nil {
+			//the option is set anyway
+			log.WithError(err).WithField("option", opt.Name).Debug("cannot read back option value")
+		}
+	}
+	return &res, nil
+}
+
+//options returns cached option descriptors of the source
+func (s *PaperSource) options() ([]*OptionDescriptor, error) {
+	s.mu.Lock()
+	loaded := s.opts != nil
+	opts := s.opts
+	s.mu.Unlock()
+	if loaded {
+		return opts, nil
+	}
+	if err := s.reloadOptions(); err != nil {
+		return nil, err
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opts, nil
+}
+
+//reloadOptions fetches option descriptors from the driver. Descriptors are never modified once they're
+//returned to the user: the new ones replace the cached list, see OptionDescriptor.current.
+func (s *PaperSource) reloadOptions() error {
+	opts, err := s.source.options()
+	if err != nil {
+		return err
+	}
+	for _, o := range opts {
+		o.source = s
+	}
+	s.mu.Lock()
+	s.opts = opts
+	s.mu.Unlock()
 	return nil
 }
 
-//SetOption accepts string representation of value, converts it to the actual type of the option and sets it.
-func (s *PaperSource) SetOption(name string, val string) error {
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-	cName := C.CString(name)
-	defer C.free(unsafe.Pointer(cName))
-	cVal := C.CString(val)
-	defer C.free(unsafe.Pointer(cVal))
-	C.lis_set_option_proxy(s.source, cName, cVal, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		return errors.New(errProxy.Error())
+//cachedOption returns the cached descriptor with the name, nil if there is none
+func (s *PaperSource) cachedOption(name string) *OptionDescriptor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.opts {
+		if o.Name == name {
+			return o
+		}
 	}
 	return nil
 }
 
+func (s *PaperSource) findOption(name string) (*OptionDescriptor, error) {
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		if o.Name == name {
+			return o, nil
+		}
+	}
+	return nil, newError(LisErrInvalidValue, "SetValue", fmt.Sprintf("option '%s' not found", name))
+}
+
 //ScanStart creates scanning session
 func (s *PaperSource) ScanStart() (*ScanSession, error) {
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-	var err error
-	lisSession := C.lis_item_scan_start_proxy(s.source, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		err = errors.New(errProxy.Error())
+	return s.ScanStartContext(context.Background())
+}
+
+//ScanStartContext creates scanning session unless ctx ends first. In that case ctx.Err() is returned
+//and the session is cancelled as soon as the driver gives it back.
+func (s *PaperSource) ScanStartContext(ctx context.Context) (*ScanSession, error) {
+	limit := s.lis.getTimeouts().ScanStart
+	tctx, cancel := withTimeout(ctx, limit)
+	defer cancel()
+	session, err := s.scanStartContext(tctx)
+	return session, s.lis.checkTimeout(ctx, err, "ScanStart", limit)
+}
+
+func (s *PaperSource) scanStart() (*ScanSession, error) {
+	session, err := s.source.scanStart()
+	if err != nil {
 		return nil, err
 	}
+	return &ScanSession{session: session, lis: s.lis, bufferSize: ScanSessionCBufferSize}, nil
+}
 
-	session := ScanSession{
-		lisScanSession: lisSession,
-		cBuffer:        C.calloc(ScanSessionCBufferSize, C.sizeof_char),
-		//init C.struct_lis_scan_parameters to it's default which is supposedly zeroed memory
+func (s *PaperSource) scanStartContext(ctx context.Context) (*ScanSession, error) {
+	if ctx.Done() == nil {
+		return s.scanStart()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var session *ScanSession
+	var err error
+	done := runAsync(func() {
+		session, err = s.scanStart()
+	})
+	select {
+	case <-done:
+		return session, err
+	case <-ctx.Done():
+		go func() {
+			<-done
+			if err == nil {
+				session.Cancel()
+				session.Close()
+			}
+		}()
+		return nil, ctx.Err()
 	}
-	return &session, nil
 }
 
 //ScanSession is just a scan session
 type ScanSession struct {
-	lisScanSession *C.struct_lis_scan_session
-	//ecError        *CErrorProxy
-	cBuffer unsafe.Pointer
+	session backendSession
+	lis     *lisgo
+	//pending is closed when the scan_read abandoned by ScanReadContext returns
+	pending <-chan struct{}
+	//page is the last page returned by NextPage, pages is the count of them
+	page     *PageReader
+	pages    int
+	progress func(Progress)
+	//bufferSize is the most ScanRead returns at once
+	bufferSize int
+}
+
+//NextPage returns the reader of the next page or io.EOF at the end of feed. The previous page is drained
+//if it hasn't been read to the end. Scan parameters are fetched for every page since they may differ,
+//e.g. between the sides of a duplex scan.
+func (s *ScanSession) NextPage(ctx context.Context) (*PageReader, error) {
+	if s.page != nil {
+		if err := s.page.drain(ctx); err != nil {
+			return nil, err
+		}
+		s.page = nil
+	}
+	if s.EndOfFeed() {
+		return nil, io.EOF
+	}
+	params, err := s.GetScanParameters()
+	if err != nil {
+		return nil, err
+	}
+	s.page = NewPageReader(s, params)
+	s.page.Index = s.pages
+	s.page.OnProgress = s.progress
+	s.pages++
+	return s.page, nil
 }
 
 //EndOfFeed indicates that there are no more to read from scanner
 func (s *ScanSession) EndOfFeed() bool {
-	return C.lis_scan_session_end_of_feed_proxy(s.lisScanSession) != 0
+	return s.session.endOfFeed()
 }
 
 //EndOfPage indicates that the current page is over
 func (s *ScanSession) EndOfPage() bool {
-	return C.lis_scan_session_end_of_page_proxy(s.lisScanSession) != 0
+	return s.session.endOfPage()
+}
+
+//SetBufferSize sets the size of the buffer the driver writes into, i.e. the most ScanRead returns at once.
+//Larger buffers mean fewer calls for large scans, up to ScanSessionMaxBufferSize. The buffer is reallocated by the next ScanRead.
+func (s *ScanSession) SetBufferSize(size int) error {
+	if size <= 0 || size > ScanSessionMaxBufferSize {
+		return newError(LisErrInvalidValue, "SetBufferSize", fmt.Sprintf("buffer size %d", size))
+	}
+	s.bufferSize = size
+	return nil
+}
+
+//BufferSize returns the size of the buffer, ScanSessionCBufferSize unless SetBufferSize is called
+func (s *ScanSession) BufferSize() int {
+	return s.bufferSize
 }
 
 //ScanRead reads data from scanner
 func (s *ScanSession) ScanRead() ([]byte, uint64, error) {
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-	//var err error
-	var arrlen C.size_t = ScanSessionCBufferSize
-	C.lis_scan_session_scan_read_proxy(s.lisScanSession, s.cBuffer, &arrlen, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		return nil, 0, errors.New(errProxy.Error())
+	return s.ScanReadContext(context.Background())
+}
+
+//ScanReadContext reads data from scanner unless ctx ends first. In that case the session is cancelled
+//(lis_scan_session_cancel) and ctx.Err() is returned.
+func (s *ScanSession) ScanReadContext(ctx context.Context) ([]byte, uint64, error) {
+	limit := s.lis.getTimeouts().Read
+	tctx, cancel := withTimeout(ctx, limit)
+	defer cancel()
+	data, n, err := s.scanReadContext(tctx)
+	return data, n, s.lis.checkTimeout(ctx, err, "ScanRead", limit)
+}
+
+func (s *ScanSession) scanReadContext(ctx context.Context) ([]byte, uint64, error) {
+	if err := s.waitPending(ctx); err != nil {
+		return nil, 0, err
 	}
 
-	//Very very strong magic here
-	data := (*[maxSliceLen]byte)(s.cBuffer)[:arrlen:arrlen]
-	return data, uint64(arrlen), nil
+	var data []byte
+	var err error
+	size := s.bufferSize
+	if ctx.Done() == nil {
+		data, err = s.session.scanRead(size)
+	} else {
+		done := runAsync(func() {
+			data, err = s.session.scanRead(size)
+		})
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.session.cancel()
+			s.pending = done
+			return nil, 0, ctx.Err()
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, uint64(len(data)), nil
+}
+
+//waitPending waits for the scan_read call abandoned by ScanReadContext, the driver doesn't expect concurrent calls
+func (s *ScanSession) waitPending(ctx context.Context) error {
+	if s.pending == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-s.pending:
+		s.pending = nil
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+//Cancel asks the driver to stop scanning, it's safe to call it while ScanRead is in progress
 func (s *ScanSession) Cancel() {
-	C.lis_scan_session_cancel_proxy(s.lisScanSession)
+	s.session.cancel()
 }
 
 //GetScanParameters returns scanning session parameters
 func (s *ScanSession) GetScanParameters() (*ScanParameters, error) {
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
-	var params ScanParameters
-	C.lis_scan_session_get_scan_parameters_proxy(s.lisScanSession, &params.lisScanParameters, errProxy.GetProxy())
-	var err error
-	if errProxy.ErrNum() != LisOk {
-		err = errors.New(errProxy.Error())
-	}
-	return &params, err
+	return s.session.scanParameters()
 }
 
-//Close frees all allocated resources
+//Close frees all allocated resources. If a read abandoned by ScanReadContext is still in progress,
+//resources are freed once it returns.
 func (s *ScanSession) Close() {
-	C.free(s.cBuffer)
+	if s.pending != nil {
+		pending := s.pending
+		s.pending = nil
+		go func() {
+			<-pending
+			s.session.close()
+		}()
+		return
+	}
+	s.session.close()
 }
 
 //Width of the image in pixels. This value is guaranteed to be true when scanning
 func (sp *ScanParameters) Width() int {
-	return int(sp.lisScanParameters.width)
+	return sp.width
 }
 
 //Height of the image in pixels. warning This value is *not* guaranteed to be true when scanning.
 func (sp *ScanParameters) Height() int {
-	return int(sp.lisScanParameters.height)
+	return sp.height
 }
 
 //ImageFormat is image format. This value is guaranteed to be true when scanning.
-func (sp *ScanParameters) ImageFormat() uint32 {
-	return sp.lisScanParameters.format
+func (sp *ScanParameters) ImageFormat() ImageFormat {
+	return sp.format
 }
 
 //ImageFormatStr returns name of the image format
 func (sp *ScanParameters) ImageFormatStr() string {
-	return lisImageFormatNames[sp.ImageFormat()]
+	return sp.ImageFormat().String()
 }
 
-
 //ImageSize is estimated image size in bytes. Can be used to pre-allocate memory.
 //This value is *not* guaranteed to be true when scanning.
 func (sp *ScanParameters) ImageSize() uint {
-	return uint(sp.lisScanParameters.image_size)
+	return sp.imageSize
 }
 
 func (sp *ScanParameters) String() string {
 	return fmt.Sprintf("WxH: %dx%d\n"+
 		"Size: %d bytes\n"+
 		"Format: %d (%s)\n",
-		sp.Width(), sp.Height(), sp.ImageSize(), sp.ImageFormat(), lisImageFormatNames[sp.ImageFormat()])
+		sp.Width(), sp.Height(), sp.ImageSize(), sp.ImageFormat(), sp.ImageFormat())
 }
 
 //ListSources gets all scan sources (flatbed, auto-feeder)
@@ -6,13 +6,19 @@
 #include <libinsane/util.h>
 
 
+#define ERROR_PROXY_BUF_SIZE 1000
+
+//error_proxy receives the error code, the name of the failed proxy function and the libinsane error message
 struct error_proxy {
 	char *buf;
 	enum lis_error err;
+	const char *func;
 };
 
+void set_error(struct error_proxy*, enum lis_error, const char*);
+
 //lis_api functions
-struct lis_device_descriptor**  lis_api_list_devices_proxy(struct lis_api*, struct error_proxy*);
+struct lis_device_descriptor**  lis_api_list_devices_proxy(struct lis_api*, enum lis_device_locations, struct error_proxy*);
 struct lis_item*                lis_api_get_device_proxy(struct lis_api*, const char*, struct error_proxy*);
 struct lis_api*                 lis_api_get_api(struct error_proxy*);
 void                            lis_api_cleanup_proxy(struct lis_api*);
@@ -29,7 +35,7 @@ void    lis_scan_session_get_scan_parameters_proxy(struct lis_scan_session*, str
 int     lis_scan_session_end_of_feed_proxy(struct lis_scan_session*);
 int     lis_scan_session_end_of_page_proxy(struct lis_scan_session*);
 void    lis_scan_session_cancel_proxy(struct lis_scan_session*);
-void    lis_scan_session_scan_read_proxy(struct lis_scan_session*, void*, size_t*, struct error_proxy*);
+void    lis_scan_session_scan_read_proxy(struct lis_scan_session*, void*, size_t*, int, struct error_proxy*);
 
 //lis_value debugging functions
 void lis_value_print(enum lis_value_type, union lis_value*);
@@ -37,7 +43,7 @@ void lis_value_array_print(enum lis_value_type, union lis_value*, int);
 
 //lis_option functions
 union lis_value* lis_option_descriptor_get_value_proxy(struct lis_option_descriptor*, struct error_proxy*);
-void             lis_set_option_proxy(struct lis_item*, char*, char*, struct error_proxy*);
+void             lis_option_descriptor_set_value_proxy(struct lis_option_descriptor*, int, double, char*, int*, struct error_proxy*);
 
 //utils functions
 int  lis_array_length(void*);
@@ -0,0 +1,359 @@
+package lisgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetDevice(t *testing.T) {
+	tests := []struct {
+		name     string
+		cacheTTL time.Duration
+		id       string
+		want     *Scanner
+	}{
+		{"direct", 0, testDeviceID, &Scanner{DeviceID: testDeviceID, Vendor: "lisgo", Model: "Virtual Scanner"}},
+		{"cached", time.Minute, testDeviceID, &Scanner{DeviceID: testDeviceID, Vendor: "lisgo", Model: "Virtual Scanner", Type: "flatbed scanner"}},
+		{"unknown", 0, "fake:lisgo:Nothing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lis, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lis.Close()
+			if tt.cacheTTL > 0 {
+				lis.SetDeviceCacheTTL(tt.cacheTTL)
+				if _, err = lis.ListDevices(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dev, err := lis.GetDevice(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if dev != nil {
+					t.Fatalf("got %+v, want nil", dev)
+				}
+				return
+			}
+			if dev == nil {
+				t.Fatal("device is not found")
+			}
+			if dev.lisDevice != nil {
+				t.Error("GetDevice has returned an open device")
+			}
+			if dev.DeviceID != tt.want.DeviceID || dev.Vendor != tt.want.Vendor || dev.Model != tt.want.Model || dev.Type != tt.want.Type {
+				t.Errorf("got %s/%s/%s/%s, want %s/%s/%s/%s", dev.DeviceID, dev.Vendor, dev.Model, dev.Type,
+					tt.want.DeviceID, tt.want.Vendor, tt.want.Model, tt.want.Type)
+			}
+			//the device works after Open and Close is safe to repeat
+			if err = dev.Open(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = dev.GetPaperSource("flatbed"); err != nil {
+				t.Error(err)
+			}
+			dev.Close()
+			dev.Close()
+		})
+	}
+}
+
+func TestReloadOptionsKeepsDescriptors(t *testing.T) {
+	cfg := testOptionsConfig()
+	for _, o := range cfg.Devices[0].Sources[0].Options {
+		if o.Name == "threshold" {
+			o.SetFlags = LisSetFlagMustReloadOptions
+		}
+	}
+	ps, release := testSourceWith(t, cfg, "flatbed")
+	defer release()
+	old, err := ps.Option("threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := ps.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//descriptors handed out before are read while the options are reloaded
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for _, o := range opts {
+				_ = o.Capabilities
+				if o.Constraint != nil {
+					_ = o.Constraint.ConstraintType
+				}
+			}
+		}
+	}()
+	for v := 0; v <= 100; v += 10 {
+		if err = ps.SetInt("threshold", v); err != nil {
+			break
+		}
+	}
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err := ps.Option("threshold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur == old {
+		t.Error("options are not reloaded")
+	}
+	//the old descriptor works thru the new one
+	if _, err = old.SetValue(intValue(30)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := old.GetValue(); err != nil || v.IntValue != 30 {
+		t.Errorf("got %v, %v, want 30", v, err)
+	}
+}
+
+//slowSource opens the flatbed which takes delay for every read
+func slowSource(t *testing.T, delay time.Duration) (ps *PaperSource, release func()) {
+	t.Helper()
+	cfg := DefaultFakeConfig()
+	cfg.Devices[0].Sources[0].ReadDelay = delay
+	return testSourceWith(t, cfg, "flatbed")
+}
+
+func TestScanStartContext(t *testing.T) {
+	ps, release := slowSource(t, 0)
+	defer release()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"background", context.Background(), nil},
+		{"cancelled", cancelled, context.Canceled},
+		{"expired", expired, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		session, err := ps.ScanStartContext(tt.ctx)
+		if err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+		if session != nil {
+			session.Close()
+		}
+	}
+}
+
+func TestScanReadContext(t *testing.T) {
+	tests := []struct {
+		name string
+		//end ends the context after the delay, nil keeps it
+		end  func(ctx context.Context) (context.Context, context.CancelFunc)
+		want error
+	}{
+		{"no end", nil, nil},
+		{"deadline", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			return context.WithTimeout(ctx, 20*time.Millisecond)
+		}, context.DeadlineExceeded},
+		{"cancel", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(ctx)
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay := 200 * time.Millisecond
+			if tt.end == nil {
+				delay = time.Millisecond
+			}
+			ps, release := slowSource(t, delay)
+			defer release()
+			session, err := ps.ScanStart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+
+			ctx := context.Background()
+			if tt.end != nil {
+				var cancel context.CancelFunc
+				ctx, cancel = tt.end(ctx)
+				defer cancel()
+			}
+			start := time.Now()
+			data, n, err := session.ScanReadContext(ctx)
+			if err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if tt.want == nil {
+				if n == 0 || int(n) != len(data) {
+					t.Errorf("got %d bytes, n %d", len(data), n)
+				}
+				return
+			}
+			if elapsed := time.Since(start); elapsed >= delay {
+				t.Errorf("ScanReadContext has waited %v for the read", elapsed)
+			}
+			//the session is cancelled, the abandoned read is waited for
+			if _, _, err = session.ScanRead(); !errors.Is(err, ErrCancelled) {
+				t.Errorf("got %v after the context end, want %v", err, ErrCancelled)
+			}
+		})
+	}
+}
+
+func TestScannerNotOpen(t *testing.T) {
+	lis, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	dev, err := lis.GetDevice(testDeviceID)
+	if err != nil || dev == nil {
+		t.Fatalf("GetDevice: %v, %v", dev, err)
+	}
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"GetPaperSource", func() error { _, err := dev.GetPaperSource("flatbed"); return err }},
+		{"Options", func() error { _, err := dev.Options(); return err }},
+		{"Option", func() error { _, err := dev.Option("lamp_off_time"); return err }},
+		{"SetOption", func() error { _, err := dev.SetOption("lamp_off_time", "5"); return err }},
+	}
+	check := func(state string, open bool) {
+		for _, c := range calls {
+			err := c.call()
+			if open && err != nil {
+				t.Errorf("%s: %s: %v", state, c.name, err)
+			}
+			if !open && !errors.Is(err, ErrClosed) {
+				t.Errorf("%s: %s returned %v, want ErrClosed", state, c.name, err)
+			}
+		}
+	}
+	check("new", false)
+	if err = dev.Open(); err != nil {
+		t.Fatal(err)
+	}
+	check("open", true)
+	dev.Close()
+	check("closed", false)
+
+	//IterateSources opens the device for the iteration
+	var names []string
+	err = dev.IterateSources(func(s *PaperSource) bool {
+		names = append(names, s.Name)
+		return true
+	})
+	if err != nil || len(names) != 2 {
+		t.Errorf("IterateSources: %v, %v", names, err)
+	}
+}
+
+func TestDeviceOptions(t *testing.T) {
+	lis, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	dev, err := lis.GetDevice(testDeviceID)
+	if err != nil || dev == nil {
+		t.Fatalf("GetDevice: %v, %v", dev, err)
+	}
+	if err = dev.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+
+	names := func(opts []*OptionDescriptor) map[string]bool {
+		res := make(map[string]bool)
+		for _, o := range opts {
+			res[o.Name] = true
+		}
+		return res
+	}
+	opts, err := dev.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(opts); len(got) != 1 || !got["lamp_off_time"] {
+		t.Fatalf("device options are %v, want lamp_off_time", got)
+	}
+
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"30", true},
+		{"0", true},
+		{"61", false},
+		{"soon", false},
+	}
+	for _, tt := range tests {
+		_, err := dev.SetOption("lamp_off_time", tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("SetOption(lamp_off_time, %s): %v", tt.value, err)
+		}
+	}
+	if _, err = dev.SetOption("lamp_off_time", "15"); err != nil {
+		t.Fatal(err)
+	}
+	o, err := dev.Option("lamp_off_time")
+	if err != nil || o == nil {
+		t.Fatalf("Option(lamp_off_time): %v, %v", o, err)
+	}
+	if v, err := o.GetValue(); err != nil || v.IntValue != 15 {
+		t.Errorf("lamp_off_time is %v, %v, want 15", v, err)
+	}
+
+	//the sources have options of their own
+	if _, err = dev.SetOption(OptionResolution, "300"); err == nil {
+		t.Errorf("SetOption(%s) on the device succeeded", OptionResolution)
+	}
+	err = dev.IterateSources(func(s *PaperSource) bool {
+		opts, err := s.Options()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(opts); got["lamp_off_time"] || !got[OptionResolution] {
+			t.Errorf("%s: options are %v", s.Name, got)
+		}
+		if _, err = s.SetOption("lamp_off_time", "5"); err == nil {
+			t.Errorf("%s: SetOption(lamp_off_time) succeeded", s.Name)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, err = dev.Option("lamp_off_time"); err != nil || o == nil {
+		t.Fatalf("Option(lamp_off_time): %v, %v", o, err)
+	}
+	if v, err := o.GetValue(); err != nil || v.IntValue != 15 {
+		t.Errorf("lamp_off_time is %v, %v after the sources, want 15", v, err)
+	}
+}
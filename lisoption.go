@@ -1,19 +1,32 @@
 package lisgo
 
-/*
-#include <libinsane/capi.h>
-#include <lislib.h>
-*/
-import "C"
 import (
 	"errors"
 	"fmt"
-	"unsafe"
+	"math"
+	"strconv"
+	"strings"
 )
 
+//LIS_SET_FLAG_* bits reported by set_value
+const (
+	LisSetFlagInexact           = 1 << 0 //the driver has applied a value different from the requested one
+	LisSetFlagMustReloadOptions = 1 << 1 //other options may have changed (including their capabilities and constraints)
+	LisSetFlagMustReloadParams  = 1 << 2 //scan parameters may have changed
+)
+
+//ValueType is enum lis_value_type, the type of an option value
+type ValueType uint32
+
+//Unit is enum lis_unit, the unit of an option value
+type Unit uint32
+
+//ImageFormat is enum lis_img_format, the format of the data returned by ScanRead
+type ImageFormat uint32
+
 //lis_value_type enum
 const (
-	LisTypeBool = iota
+	LisTypeBool ValueType = iota
 	LisTypeInteger
 	LisTypeDouble
 	LisTypeString
@@ -50,7 +63,7 @@ const (
 	* - 8bits for blue.
 	*
 	* No header, just pixels. */
-	LisImgFormatRawRGB24 = iota
+	LisImgFormatRawRGB24 ImageFormat = iota
 	LisImgFormatGrayScale8
 	LisImgFormatBW1
 	LisImgFormatBmp
@@ -71,7 +84,7 @@ const (
 
 //enum lis_unit
 const (
-	LisUnitNone = iota
+	LisUnitNone Unit = iota
 	LisUnitPixel
 	LisUnitBit
 	LisUnitMM
@@ -88,7 +101,7 @@ var (
 		LisCapSwSelect:  "LisCapSwSelect",
 		LisCapInactive:  "LisCapInactive"}
 
-	lisTypeNames = map[uint32]string{
+	lisTypeNames = map[ValueType]string{
 		LisTypeBool:        "Bool",
 		LisTypeInteger:     "Integer",
 		LisTypeDouble:      "Double",
@@ -100,7 +113,7 @@ var (
 		LisConstraintRange: "Range",
 		LisConstraintList:  "List"}
 
-	lisImageFormatNames = map[uint32]string{
+	lisImageFormatNames = map[ImageFormat]string{
 		LisImgFormatRawRGB24:   "Raw RGB24",
 		LisImgFormatGrayScale8: "Grayscale 8",
 		LisImgFormatBW1:        "BW1",
@@ -120,7 +133,7 @@ var (
 		LisImgFormatTiff:       "TIFF",
 	}
 
-	lisUnitNames = map[uint32]string{
+	lisUnitNames = map[Unit]string{
 		LisUnitNone:        "None",
 		LisUnitPixel:       "Pixel",
 		LisUnitBit:         "Bit",
@@ -134,12 +147,12 @@ var (
 type (
 	//LisValue is value of option
 	LisValue struct {
-		ValType     uint32
+		ValType     ValueType
 		BoolValue   bool
 		IntValue    int
 		DoubleValue float64
 		StringValue string
-		ImgFormat   C.enum_lis_img_format
+		ImgFormat   ImageFormat
 	}
 
 	//ValueRange define constraints applied to value
@@ -170,11 +183,26 @@ type (
 		* -  LIS_CAP_INACTIVE */
 		Capabilities int
 		// Type of this option.
-		ValueType C.enum_lis_value_type
+		ValueType ValueType
 		// Unit of this value. Only useful for integers and float.
-		ValueUnit  C.enum_lis_unit
+		ValueUnit  Unit
 		Constraint *OptionConstraint
-		optStruct  *C.struct_lis_option_descriptor
+		opt        backendOption
+		source     *PaperSource
+	}
+
+	//SetResult describes what has happened after setting an option
+	SetResult struct {
+		//Inexact is set when the driver has adjusted the value (LIS_SET_FLAG_INEXACT)
+		Inexact bool
+		//ReloadOptions is set when other options may have changed, the paper source has reloaded them already
+		ReloadOptions bool
+		//ReloadParams is set when scan parameters may have changed
+		ReloadParams bool
+		//Value is the value actually applied, as read back from the driver. It's nil if the option is not readable.
+		Value *LisValue
+		//Snapped is set by SetOptionNearest when the requested value has been replaced by the nearest legal one
+		Snapped bool
 	}
 
 	//OptionConstraint describe restrictions defining the possible values for this option.
@@ -194,20 +222,284 @@ type (
 
 //GetValue obtains value of an option
 func (o *OptionDescriptor) GetValue() (*LisValue, error) {
+	o = o.current()
 	if !o.IsReadable() {
 		return nil, errors.New("сannot read the option")
 	}
 
-	errProxy := getErrorProxy()
-	defer releaseErrorProxy(errProxy)
+	return o.opt.getValue()
+
+}
+
+//SetValue checks v against the constraint and sets it, see PaperSource.SetValue
+func (o *OptionDescriptor) SetValue(v LisValue) (*SetResult, error) {
+	if o.source == nil {
+		return nil, errors.New("the option doesn't belong to a paper source")
+	}
+	return o.source.setValue(o.current(), v)
+}
+
+//current returns the descriptor of the option loaded last. Descriptors are snapshots: when the driver asks
+//to reload options, PaperSource.Options returns new ones with the current capabilities and constraint,
+//while the old ones keep working thru the new ones.
+func (o *OptionDescriptor) current() *OptionDescriptor {
+	if o.source == nil {
+		return o
+	}
+	if cur := o.source.cachedOption(o.Name); cur != nil {
+		return cur
+	}
+	return o
+}
+
+//checkValue validates v against the option's type, capabilities and constraint.
+//It returns the value to pass to the driver: integers are converted for double options.
+func (o *OptionDescriptor) checkValue(v LisValue) (*LisValue, error) {
+	if !o.IsWritable() || !o.IsReadable() {
+		return nil, newError(LisErrAccessDenied, "SetValue", fmt.Sprintf("option '%s' cannot be set", o.Name))
+	}
+	if v.ValType == LisTypeInteger && o.ValueType == LisTypeDouble {
+		v = LisValue{ValType: LisTypeDouble, DoubleValue: float64(v.IntValue)}
+	}
+	if v.ValType != o.ValueType {
+		return nil, newError(LisErrInvalidValue, "SetValue", fmt.Sprintf("option '%s' is of type %s, not %s",
+			o.Name, o.ValueType, v.ValType))
+	}
+	if o.Constraint == nil {
+		return &v, nil
+	}
+	switch o.Constraint.ConstraintType {
+	case LisConstraintList:
+		if o.Constraint.PossibleList.findExact(&v) != nil {
+			return &v, nil
+		}
+		//a string in another case is set the way the driver spells it
+		if p := o.Constraint.PossibleList.findFold(&v); p != nil {
+			pv := *p
+			return &pv, nil
+		}
+		allowed := make([]string, 0, len(o.Constraint.PossibleList))
+		for _, p := range o.Constraint.PossibleList {
+			allowed = append(allowed, p.String())
+		}
+		return nil, newError(LisErrInvalidValue, "SetValue", fmt.Sprintf("value %s is not allowed for option '%s', allowed values: %s",
+			&v, o.Name, strings.Join(allowed, ", ")))
+	case LisConstraintRange:
+		r := o.Constraint.PossibleRange
+		if r != nil && !r.contains(&v) {
+			return nil, newError(LisErrInvalidValue, "SetValue", fmt.Sprintf("value %s is out of range of option '%s': min %s, max %s, interval %s",
+				&v, o.Name, r.MinValue, r.MaxValue, r.Interval))
+		}
+	}
+	return &v, nil
+}
+
+//parseValue converts string representation of the value to the given type, like lis_set_option does
+func parseValue(typ ValueType, val string) (*LisValue, error) {
+	res := LisValue{ValType: typ}
 	var err error
-	val := C.lis_option_descriptor_get_value_proxy(o.optStruct, errProxy.GetProxy())
-	if errProxy.ErrNum() != LisOk {
-		err = errors.New(errProxy.Error())
-		return nil, err
+	switch typ {
+	case LisTypeBool:
+		res.BoolValue, err = strconv.ParseBool(val)
+	case LisTypeInteger:
+		res.IntValue, err = strconv.Atoi(val)
+	case LisTypeDouble:
+		res.DoubleValue, err = strconv.ParseFloat(val, 64)
+	case LisTypeString:
+		res.StringValue = val
+	default:
+		err = fmt.Errorf("unsupported value type %s", typ)
+	}
+	if err != nil {
+		return nil, newError(LisErrInvalidValue, "SetOption", err.Error())
+	}
+	return &res, nil
+}
+
+//equal compares values of the same type
+func (v *LisValue) equal(other *LisValue) bool {
+	if v.ValType != other.ValType {
+		return false
+	}
+	switch v.ValType {
+	case LisTypeDouble:
+		return math.Abs(v.DoubleValue-other.DoubleValue) < doubleTolerance
+	}
+	return v.String() == other.String()
+}
+
+//doubleTolerance is used to compare double values coming from drivers
+const doubleTolerance = 1e-6
+
+//contains checks min, max and interval (if it's not zero) for integer and double values
+func (r *ValueRange) contains(v *LisValue) bool {
+	switch v.ValType {
+	case LisTypeInteger:
+		min, max, step := r.MinValue.IntValue, r.MaxValue.IntValue, r.Interval.IntValue
+		return v.IntValue >= min && v.IntValue <= max && (step <= 0 || (v.IntValue-min)%step == 0)
+	case LisTypeDouble:
+		min, max, step := r.MinValue.DoubleValue, r.MaxValue.DoubleValue, r.Interval.DoubleValue
+		if v.DoubleValue < min-doubleTolerance || v.DoubleValue > max+doubleTolerance {
+			return false
+		}
+		return step <= 0 || math.Abs(math.Remainder(v.DoubleValue-min, step)) < doubleTolerance
+	}
+	return true
+}
+
+//Contains tells if v is a legal value as SetValue checks it: an integer is accepted for a double, strings are compared case insensitive.
+func (c *OptionConstraint) Contains(v LisValue) bool {
+	if c == nil {
+		return true
+	}
+	switch c.ConstraintType {
+	case LisConstraintList:
+		return c.PossibleList.findExact(&v) != nil || c.PossibleList.findFold(&v) != nil
+	case LisConstraintRange:
+		if c.PossibleRange == nil || c.PossibleRange.MinValue == nil {
+			return true
+		}
+		rv, ok := v.toType(c.PossibleRange.MinValue.ValType)
+		return ok && c.PossibleRange.contains(rv)
+	}
+	return true
+}
+
+//Nearest returns the legal value closest to v: the closest number of the list, the closest number of the range
+//respecting the interval, or the string of the list equal to v ignoring case.
+//It returns false if there is no such value (e.g. a string is not in the list).
+func (c *OptionConstraint) Nearest(v LisValue) (LisValue, bool) {
+	if c == nil {
+		return v, true
+	}
+	switch c.ConstraintType {
+	case LisConstraintList:
+		if p := c.PossibleList.find(&v); p != nil {
+			return *p, true
+		}
+		f, ok := v.number()
+		if !ok {
+			return LisValue{}, false
+		}
+		var best *LisValue
+		var bestDist float64
+		for _, p := range c.PossibleList {
+			pf, ok := p.number()
+			if !ok {
+				continue
+			}
+			if dist := math.Abs(pf - f); best == nil || dist < bestDist {
+				best, bestDist = p, dist
+			}
+		}
+		if best == nil {
+			return LisValue{}, false
+		}
+		return *best, true
+	case LisConstraintRange:
+		if c.PossibleRange == nil {
+			return v, true
+		}
+		return c.PossibleRange.nearest(&v)
+	}
+	return v, true
+}
+
+//nearest clamps v to the range and rounds it to the interval
+func (r *ValueRange) nearest(v *LisValue) (LisValue, bool) {
+	f, ok := v.number()
+	if !ok || r.MinValue == nil || r.MaxValue == nil {
+		return LisValue{}, false
+	}
+	min, ok := r.MinValue.number()
+	if !ok {
+		return LisValue{}, false
+	}
+	max, _ := r.MaxValue.number()
+	var step float64
+	if r.Interval != nil {
+		step, _ = r.Interval.number()
 	}
-	return NewValue(val, o.ValueType), nil
+	f = math.Max(min, math.Min(max, f))
+	if step > 0 {
+		f = min + math.Round((f-min)/step)*step
+		if f > max+doubleTolerance {
+			f -= step
+		}
+	}
+	if r.MinValue.ValType == LisTypeInteger {
+		return LisValue{ValType: LisTypeInteger, IntValue: int(math.Round(f))}, true
+	}
+	return LisValue{ValType: LisTypeDouble, DoubleValue: f}, true
+}
+
+//findExact returns the list value equal to v, an integer v is compared to double values
+func (l ValueList) findExact(v *LisValue) *LisValue {
+	for _, p := range l {
+		pv := v
+		if v.ValType == LisTypeInteger && p.ValType == LisTypeDouble {
+			pv = &LisValue{ValType: LisTypeDouble, DoubleValue: float64(v.IntValue)}
+		}
+		if p.equal(pv) {
+			return p
+		}
+	}
+	return nil
+}
 
+//find returns the list value equal to v for Nearest. Integer and double values are comparable,
+//strings are compared case insensitive if there is no exact match.
+func (l ValueList) find(v *LisValue) *LisValue {
+	for _, p := range l {
+		if pv, ok := v.toType(p.ValType); ok && p.equal(pv) {
+			return p
+		}
+	}
+	return l.findFold(v)
+}
+
+//findFold returns the list string equal to v in another case
+func (l ValueList) findFold(v *LisValue) *LisValue {
+	if v.ValType != LisTypeString {
+		return nil
+	}
+	for _, p := range l {
+		if p.ValType == LisTypeString && strings.EqualFold(p.StringValue, v.StringValue) {
+			return p
+		}
+	}
+	return nil
+}
+
+//number returns integer and double values as float64
+func (v *LisValue) number() (float64, bool) {
+	switch v.ValType {
+	case LisTypeInteger:
+		return float64(v.IntValue), true
+	case LisTypeDouble:
+		return v.DoubleValue, true
+	}
+	return 0, false
+}
+
+//toType converts between integer and double values, a double converts to an integer only if it has no fraction
+func (v *LisValue) toType(typ ValueType) (*LisValue, bool) {
+	if v.ValType == typ {
+		return v, true
+	}
+	f, ok := v.number()
+	if !ok {
+		return nil, false
+	}
+	switch typ {
+	case LisTypeDouble:
+		return &LisValue{ValType: LisTypeDouble, DoubleValue: f}, true
+	case LisTypeInteger:
+		if math.Abs(f-math.Round(f)) < doubleTolerance {
+			return &LisValue{ValType: LisTypeInteger, IntValue: int(math.Round(f))}, true
+		}
+	}
+	return nil, false
 }
 
 //Print option using fmt
@@ -225,13 +517,13 @@ func (o *OptionDescriptor) String() string {
 	return fmt.Sprintf(
 		"%s (%s;%s)\n"+
 			"Caps: %v %s\n"+
-			"Type: %v (%v)\n"+
-			"Units: %v (%s)\n"+
+			"Type: %d (%s)\n"+
+			"Units: %d (%s)\n"+
 			"Constraint: %v\n",
 		o.Name, o.Title, o.Desc,
 		o.Capabilities, o.formatCaps(),
-		o.ValueType, o.formatType(),
-		o.ValueUnit, lisUnitNames[o.ValueUnit],
+		o.ValueType, o.ValueType,
+		o.ValueUnit, o.ValueUnit,
 		o.formatConstraint()) + valStr
 }
 
@@ -263,10 +555,6 @@ func (o *OptionDescriptor) formatCaps() string {
 	return fmt.Sprintf("[%s]", caps[:len(caps)-1])
 }
 
-func (o *OptionDescriptor) formatType() string {
-	return lisTypeNames[o.ValueType]
-}
-
 func (o *OptionDescriptor) formatConstraint() string {
 	//cons := lisConstraintNames[o.Constraint.ConstraintType]
 	cons := ""
@@ -293,6 +581,27 @@ func (o *OptionDescriptor) formatConstraint() string {
 
 }
 
+func (t ValueType) String() string {
+	if name, ok := lisTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("ValueType(%d)", uint32(t))
+}
+
+func (u Unit) String() string {
+	if name, ok := lisUnitNames[u]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unit(%d)", uint32(u))
+}
+
+func (f ImageFormat) String() string {
+	if name, ok := lisImageFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("ImageFormat(%d)", uint32(f))
+}
+
 //Print prints LisValue depending on type
 func (v *LisValue) String() string {
 	switch v.ValType {
@@ -305,74 +614,8 @@ func (v *LisValue) String() string {
 	case LisTypeString:
 		return fmt.Sprintf("%v", v.StringValue)
 	case LisTypeImageFormat:
-		return fmt.Sprintf("%v", v.ImgFormat)
-	default:
-		panic("Unknown value type")
-	}
-}
-
-//NewValue constructs GO LisValue struct from lis_value C-struct
-func NewValue(val *C.union_lis_value, typ C.enum_lis_value_type) *LisValue {
-	var res LisValue
-	res.ValType = typ
-	switch res.ValType {
-	case LisTypeBool:
-		res.BoolValue = *((*int)(unsafe.Pointer(val))) != 0
-	case LisTypeInteger:
-		res.IntValue = int(*((*C.int)(unsafe.Pointer(val))))
-	case LisTypeDouble:
-		res.DoubleValue = *((*float64)(unsafe.Pointer(val)))
-	case LisTypeString:
-		res.StringValue = C.GoString(*(**C.char)(unsafe.Pointer(val)))
-	case LisTypeImageFormat:
-		res.ImgFormat = *(*C.enum_lis_img_format)(unsafe.Pointer(val))
+		return fmt.Sprintf("%d", v.ImgFormat)
 	default:
 		panic("Unknown value type")
 	}
-	return &res
-}
-
-//NewConstraint costructs Go ValueConstraint struct from C-structs
-func NewConstraint(valType C.enum_lis_value_type, conType C.int, conPossible unsafe.Pointer) *OptionConstraint {
-	con := OptionConstraint{
-		ConstraintType: int(conType),
-	}
-
-	//conRange *C.struct_lis_value_range, conList *C.struct_lis_value_list
-
-	if con.ConstraintType == LisConstraintList {
-		conList := (*C.struct_lis_value_list)(conPossible)
-		//fmt.Printf("GO array address: %p\n", conList.values)
-		//C.lis_value_array_print(valType, conList.values, conList.nb_values)
-		con.PossibleList = []*LisValue{}
-
-		slice := carrToSlice(conList.values, int(conList.nb_values))
-		for i := range slice {
-			//C.lis_value_print(valType, &v)
-			c := NewValue(&slice[i], valType)
-			//fmt.Printf("GO element %p\n", &slice[i])
-			//fmt.Println(t)
-			con.PossibleList = append(con.PossibleList, c)
-
-		}
-		//fmt.Printf("%+v", con.PossibleList)
-	}
-
-	if con.ConstraintType == LisConstraintRange {
-		conRange := (*C.struct_lis_value_range)(conPossible)
-
-		var c ValueRange
-		c.MinValue = NewValue(&conRange.min, valType)
-		c.MaxValue = NewValue(&conRange.max, valType)
-		c.Interval = NewValue(&conRange.interval, valType)
-		con.PossibleRange = &c
-	}
-	return &con
-}
-
-func carrToSlice(arr *C.union_lis_value, count int) []C.union_lis_value {
-
-	//Apply strong magic to get GO slice backed by C null-terminated array
-	slice := (*[maxSliceLen]C.union_lis_value)(unsafe.Pointer(arr))[:count:count]
-	return slice
 }
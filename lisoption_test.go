@@ -0,0 +1,248 @@
+package lisgo
+
+import (
+	"testing"
+)
+
+//testOptionsConfig is the default virtual scanner with more constraints on the flatbed
+func testOptionsConfig() *FakeConfig {
+	intRange := func(min, max, step int) *OptionConstraint {
+		return &OptionConstraint{
+			ConstraintType: LisConstraintRange,
+			PossibleRange: &ValueRange{
+				MinValue: &LisValue{ValType: LisTypeInteger, IntValue: min},
+				MaxValue: &LisValue{ValType: LisTypeInteger, IntValue: max},
+				Interval: &LisValue{ValType: LisTypeInteger, IntValue: step},
+			},
+		}
+	}
+	cfg := DefaultFakeConfig()
+	cfg.Devices[0].Sources[0].Options = append(DefaultFakeOptions(),
+		&FakeOption{
+			Name: "threshold", Title: "Threshold", Capabilities: LisCapSwSelect, ValueType: LisTypeInteger,
+			Constraint: intRange(0, 100, 10),
+			Value:      &LisValue{ValType: LisTypeInteger, IntValue: 50},
+		},
+		&FakeOption{
+			Name: "gamma", Title: "Gamma", Capabilities: LisCapSwSelect, ValueType: LisTypeDouble,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintRange,
+				PossibleRange: &ValueRange{
+					MinValue: &LisValue{ValType: LisTypeDouble, DoubleValue: 0.5},
+					MaxValue: &LisValue{ValType: LisTypeDouble, DoubleValue: 3},
+					Interval: &LisValue{ValType: LisTypeDouble, DoubleValue: 0.25},
+				},
+			},
+			Value: &LisValue{ValType: LisTypeDouble, DoubleValue: 1},
+		},
+		&FakeOption{
+			Name: "contrast", Title: "Contrast", Capabilities: LisCapSwSelect, ValueType: LisTypeDouble,
+			Constraint: &OptionConstraint{
+				ConstraintType: LisConstraintList,
+				PossibleList: ValueList{
+					{ValType: LisTypeDouble, DoubleValue: 0.5},
+					{ValType: LisTypeDouble, DoubleValue: 1},
+					{ValType: LisTypeDouble, DoubleValue: 2},
+				},
+			},
+			Value: &LisValue{ValType: LisTypeDouble, DoubleValue: 1},
+		},
+		&FakeOption{
+			Name: "preview", Title: "Preview", Capabilities: LisCapSwSelect, ValueType: LisTypeBool,
+			Value: &LisValue{ValType: LisTypeBool},
+		},
+		&FakeOption{
+			Name: "serial", Title: "Serial number", Capabilities: 0, ValueType: LisTypeString,
+			Value: &LisValue{ValType: LisTypeString, StringValue: "42"},
+		},
+	)
+	return cfg
+}
+
+func intValue(v int) LisValue {
+	return LisValue{ValType: LisTypeInteger, IntValue: v}
+}
+
+func doubleValue(v float64) LisValue {
+	return LisValue{ValType: LisTypeDouble, DoubleValue: v}
+}
+
+func stringValue(v string) LisValue {
+	return LisValue{ValType: LisTypeString, StringValue: v}
+}
+
+func TestSetValueChecksConstraints(t *testing.T) {
+	tests := []struct {
+		name   string
+		option string
+		value  LisValue
+		want   *LisValue //nil if the value is rejected
+	}{
+		{"list int", OptionResolution, intValue(300), &LisValue{ValType: LisTypeInteger, IntValue: 300}},
+		{"list int missing", OptionResolution, intValue(200), nil},
+		{"list int as double", OptionResolution, doubleValue(300), nil},
+		{"list string", OptionMode, stringValue(FakeModeGray), &LisValue{ValType: LisTypeString, StringValue: FakeModeGray}},
+		{"list string missing", OptionMode, stringValue("Halftone"), nil},
+		{"list string other case", OptionMode, stringValue("color"), &LisValue{ValType: LisTypeString, StringValue: FakeModeColor}},
+		{"list double", "contrast", doubleValue(2), &LisValue{ValType: LisTypeDouble, DoubleValue: 2}},
+		{"list double from int", "contrast", intValue(2), &LisValue{ValType: LisTypeDouble, DoubleValue: 2}},
+		{"list double missing", "contrast", doubleValue(1.5), nil},
+		{"range int", "brightness", intValue(-100), &LisValue{ValType: LisTypeInteger, IntValue: -100}},
+		{"range int above max", "brightness", intValue(101), nil},
+		{"range int below min", "brightness", intValue(-101), nil},
+		{"range interval", "threshold", intValue(70), &LisValue{ValType: LisTypeInteger, IntValue: 70}},
+		{"range interval off step", "threshold", intValue(75), nil},
+		{"range double", OptionBRX, doubleValue(100.5), &LisValue{ValType: LisTypeDouble, DoubleValue: 100.5}},
+		{"range double from int", OptionBRX, intValue(100), &LisValue{ValType: LisTypeDouble, DoubleValue: 100}},
+		{"range double above max", OptionBRX, doubleValue(216), nil},
+		{"range double interval", "gamma", doubleValue(2.25), &LisValue{ValType: LisTypeDouble, DoubleValue: 2.25}},
+		{"range double off interval", "gamma", doubleValue(2.3), nil},
+		{"no constraint", "preview", LisValue{ValType: LisTypeBool, BoolValue: true}, &LisValue{ValType: LisTypeBool, BoolValue: true}},
+		{"wrong type", "preview", intValue(1), nil},
+		{"read only", "serial", stringValue("43"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, release := testSourceWith(t, testOptionsConfig(), "flatbed")
+			defer release()
+			res, err := ps.SetValue(tt.option, tt.value)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("%s is accepted, value %v", &tt.value, res.Value)
+				}
+				if lisErr, ok := err.(*Error); !ok || (lisErr.Code != LisErrInvalidValue && lisErr.Code != LisErrAccessDenied) {
+					t.Errorf("got %v, want invalid value or access denied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Value == nil || !res.Value.equal(tt.want) {
+				t.Errorf("got %v, want %v", res.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintContains(t *testing.T) {
+	list := &OptionConstraint{ConstraintType: LisConstraintList, PossibleList: ValueList{
+		{ValType: LisTypeString, StringValue: "Color"},
+		{ValType: LisTypeString, StringValue: "Gray"},
+		{ValType: LisTypeDouble, DoubleValue: 0.5},
+	}}
+	rng := &OptionConstraint{ConstraintType: LisConstraintRange, PossibleRange: &ValueRange{
+		MinValue: &LisValue{ValType: LisTypeInteger, IntValue: 0},
+		MaxValue: &LisValue{ValType: LisTypeInteger, IntValue: 100},
+		Interval: &LisValue{ValType: LisTypeInteger, IntValue: 10},
+	}}
+	tests := []struct {
+		name       string
+		constraint *OptionConstraint
+		value      LisValue
+		want       bool
+	}{
+		{"string", list, stringValue("Gray"), true},
+		{"string other case", list, stringValue("color"), true},
+		{"string missing", list, stringValue("Halftone"), false},
+		{"double", list, doubleValue(0.5), true},
+		{"double missing", list, doubleValue(1), false},
+		{"range", rng, intValue(70), true},
+		{"range off interval", rng, intValue(75), false},
+		{"range above max", rng, intValue(110), false},
+		{"no constraint", nil, stringValue("anything"), true},
+	}
+	for _, tt := range tests {
+		if got := tt.constraint.Contains(tt.value); got != tt.want {
+			t.Errorf("%s: Contains(%s) = %v, want %v", tt.name, &tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSetOptionNearest(t *testing.T) {
+	tests := []struct {
+		option  string
+		value   string
+		want    *LisValue //nil if there is no legal value close to value
+		snapped bool
+	}{
+		{OptionResolution, "300", &LisValue{ValType: LisTypeInteger, IntValue: 300}, false},
+		{OptionResolution, "250", &LisValue{ValType: LisTypeInteger, IntValue: 300}, true},
+		{OptionResolution, "100", &LisValue{ValType: LisTypeInteger, IntValue: 75}, true},
+		{OptionResolution, "1200", &LisValue{ValType: LisTypeInteger, IntValue: 600}, true},
+		{OptionResolution, "299.6", &LisValue{ValType: LisTypeInteger, IntValue: 300}, true},
+		{"brightness", "-7", &LisValue{ValType: LisTypeInteger, IntValue: -7}, false},
+		{"brightness", "150", &LisValue{ValType: LisTypeInteger, IntValue: 100}, true},
+		{"threshold", "74", &LisValue{ValType: LisTypeInteger, IntValue: 70}, true},
+		{"threshold", "76", &LisValue{ValType: LisTypeInteger, IntValue: 80}, true},
+		{"threshold", "-5", &LisValue{ValType: LisTypeInteger, IntValue: 0}, true},
+		{"gamma", "2.3", &LisValue{ValType: LisTypeDouble, DoubleValue: 2.25}, true},
+		{"gamma", "0.1", &LisValue{ValType: LisTypeDouble, DoubleValue: 0.5}, true},
+		{"gamma", "2.75", &LisValue{ValType: LisTypeDouble, DoubleValue: 2.75}, false},
+		{"contrast", "1.4", &LisValue{ValType: LisTypeDouble, DoubleValue: 1}, true},
+		{"contrast", "1.6", &LisValue{ValType: LisTypeDouble, DoubleValue: 2}, true},
+		{OptionBRX, "300", &LisValue{ValType: LisTypeDouble, DoubleValue: 215.9}, true},
+		{OptionMode, FakeModeColor, &LisValue{ValType: LisTypeString, StringValue: FakeModeColor}, false},
+		{OptionMode, "gray", &LisValue{ValType: LisTypeString, StringValue: FakeModeGray}, true},
+		{OptionMode, "Halftone", nil, false},
+		{"preview", "true", &LisValue{ValType: LisTypeBool, BoolValue: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option+"="+tt.value, func(t *testing.T) {
+			ps, release := testSourceWith(t, testOptionsConfig(), "flatbed")
+			defer release()
+			res, err := ps.SetOptionNearest(tt.option, tt.value)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("%s is accepted, value %v", tt.value, res.Value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Value == nil || !res.Value.equal(tt.want) || res.Snapped != tt.snapped {
+				t.Errorf("got %v snapped %v, want %v snapped %v", res.Value, res.Snapped, tt.want, tt.snapped)
+			}
+		})
+	}
+}
+
+func TestSetResultFlags(t *testing.T) {
+	cfg := testOptionsConfig()
+	//the threshold emulates a driver which changes other options
+	for _, o := range cfg.Devices[0].Sources[0].Options {
+		if o.Name == "threshold" {
+			o.SetFlags = LisSetFlagMustReloadOptions | LisSetFlagInexact
+		}
+	}
+	tests := []struct {
+		option        string
+		value         string
+		reloadOptions bool
+		reloadParams  bool
+		inexact       bool
+	}{
+		{OptionResolution, "300", false, true, false},
+		{OptionMode, FakeModeGray, false, true, false},
+		{OptionTLX, "10", false, true, false},
+		{"brightness", "10", false, false, false},
+		{"threshold", "20", true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option, func(t *testing.T) {
+			ps, release := testSourceWith(t, cfg, "flatbed")
+			defer release()
+			res, err := ps.SetOption(tt.option, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.ReloadOptions != tt.reloadOptions || res.ReloadParams != tt.reloadParams || res.Inexact != tt.inexact {
+				t.Errorf("got reload options %v, reload params %v, inexact %v", res.ReloadOptions, res.ReloadParams, res.Inexact)
+			}
+			if res.Value == nil || res.Value.String() != tt.value {
+				t.Errorf("got value %v, want %s", res.Value, tt.value)
+			}
+		})
+	}
+}
@@ -1,31 +1,43 @@
 package lisgo
 
-import "C"
 import (
 	"bytes"
-	"errors"
+	"context"
 	"github.com/apex/log"
 	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"os"
+	"time"
 
 	"golang.org/x/image/bmp"
 )
 
 //PageReader represents a single page received from scanner
 type PageReader struct {
-	Width          int
-	Height         int
-	Format         uint32
-	Session        *ScanSession
+	Width   int
+	Height  int
+	Format  ImageFormat
+	Session Session
+	Index   int //index of the page in the scan session starting from 0, set by ScanSession.NextPage
+	//OnProgress is called after every chunk read from the driver and once more at the end of the page
+	OnProgress     func(Progress)
 	internalBuffer []byte //a byte array from C-code, read-only
 	readBytes      int    //count of bytes read from internalBuffer, if equal to len(internalbuffer) then the buffer is completely read
+
+	imageSize uint64    //estimated, for progress
+	bytesRead uint64    //count of bytes received from the driver
+	started   time.Time //first read
+	done      bool      //the end of the page is reported
 }
 
-//Read portion of data from scanner into a buffer until the page is over. Optimal size of the buffer is ScanSessionCBufferSize.
+//Read portion of data from scanner into a buffer until the page is over. Optimal size of the buffer is the buffer size
+//of the session (see ScanSession.SetBufferSize), WriteTo avoids the copy altogether.
 func (sb *PageReader) Read(p []byte) (int, error) {
+	return sb.ReadContext(context.Background(), p)
+}
+
+//ReadContext is Read which gives up and cancels the scan session when ctx ends
+func (sb *PageReader) ReadContext(ctx context.Context, p []byte) (int, error) {
 	var err error
 	var bts int
 	bufcap := len(p)
@@ -53,14 +65,22 @@ func (sb *PageReader) Read(p []byte) (int, error) {
 	sb.readBytes = 0
 
 	if sb.Session.EndOfPage() {
+		if !sb.done {
+			sb.done = true
+			sb.reportProgress(0, true)
+		}
 		return 0, io.EOF
 	}
 
+	if sb.started.IsZero() {
+		sb.started = time.Now()
+	}
 	var got uint64
-	sb.internalBuffer, got, err = sb.Session.ScanRead()
+	sb.internalBuffer, got, err = sb.Session.ScanReadContext(ctx)
 	if err != nil {
 		return int(got), err
 	}
+	sb.reportProgress(got, false)
 
 	//fmt.Print("#")
 
@@ -77,10 +97,85 @@ func (sb *PageReader) Read(p []byte) (int, error) {
 	return bts, nil
 }
 
+//WriteTo writes the rest of the page to w, it implements io.WriterTo: io.Copy passes the chunks of the driver
+//to w as they are, without copying them to an intermediate buffer.
+func (sb *PageReader) WriteTo(w io.Writer) (int64, error) {
+	return sb.WriteToContext(context.Background(), w)
+}
+
+//WriteToContext is WriteTo which gives up and cancels the scan session when ctx ends
+func (sb *PageReader) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	var written int64
+	write := func(p []byte) error {
+		n, err := w.Write(p)
+		written += int64(n)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		return err
+	}
+
+	//unread data left by Read
+	if sb.readBytes > 0 && sb.readBytes < len(sb.internalBuffer) {
+		rest := sb.internalBuffer[sb.readBytes:]
+		sb.readBytes = len(sb.internalBuffer)
+		if err := write(rest); err != nil {
+			return written, err
+		}
+	}
+	sb.internalBuffer = nil
+	sb.readBytes = 0
+
+	for !sb.Session.EndOfPage() {
+		if sb.started.IsZero() {
+			sb.started = time.Now()
+		}
+		data, got, err := sb.Session.ScanReadContext(ctx)
+		if err != nil {
+			return written, err
+		}
+		sb.reportProgress(got, false)
+		if err = write(data[:got]); err != nil {
+			return written, err
+		}
+	}
+	if !sb.done {
+		sb.done = true
+		sb.reportProgress(0, true)
+	}
+	return written, nil
+}
+
+//drain reads and drops the rest of the page
+func (sb *PageReader) drain(ctx context.Context) error {
+	sb.internalBuffer = nil
+	sb.readBytes = 0
+	for !sb.Session.EndOfPage() {
+		_, got, err := sb.Session.ScanReadContext(ctx)
+		if err != nil {
+			return err
+		}
+		sb.reportProgress(got, false)
+	}
+	if !sb.done {
+		//decoders may stop reading right after the image data
+		sb.done = true
+		sb.reportProgress(0, true)
+	}
+	return nil
+}
+
+//GetImage reads and decodes the whole page
 func (sb *PageReader) GetImage() (image.Image, error) {
+	return sb.GetImageContext(context.Background())
+}
+
+//GetImageContext reads and decodes the whole page unless ctx ends first
+func (sb *PageReader) GetImageContext(ctx context.Context) (image.Image, error) {
+	r := &ctxPageReader{ctx: ctx, page: sb}
 
 	log.Debug("reading header")
-	header, buf, err := ReadBMPHeader(sb)
+	header, buf, err := ReadBMPHeader(r)
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +186,7 @@ func (sb *PageReader) GetImage() (image.Image, error) {
 		// height could be negative, that means image starts from top-left corner instead of bottom-right
 		data.Grow(int(header.PixelDataSize))
 		log.Debug("reading image data")
-		n, err := data.ReadFrom(sb)
+		n, err := data.ReadFrom(r)
 		if err != nil {
 			return nil, err
 		}
@@ -106,7 +201,7 @@ func (sb *PageReader) GetImage() (image.Image, error) {
 
 	log.Debug("reading image data")
 	// pass it to the standard bmp decoder
-	img, err := bmp.Decode(io.MultiReader(bytes.NewReader(buf), sb))
+	img, err := bmp.Decode(io.MultiReader(bytes.NewReader(buf), r))
 	log.Debug("image data is read")
 	return img, err
 }
@@ -122,14 +217,7 @@ func (sb *PageReader) WriteToFile(name string, format string) error {
 	if err != nil {
 		return err
 	}
-	switch format {
-	case "png":
-		return png.Encode(outputFile, img)
-	case "jpg":
-		return jpeg.Encode(outputFile, img, &jpeg.Options{Quality: 50})
-	}
-	return errors.New("unknown file format")
-
+	return encodeImage(outputFile, img, format)
 }
 
 //WriteToPng writes image to file
@@ -142,14 +230,25 @@ func (sb *PageReader) WriteToJpeg(name string) error {
 	return sb.WriteToFile(name, "jpg")
 }
 
+//ctxPageReader binds a context to PageReader.ReadContext to get an io.Reader
+type ctxPageReader struct {
+	ctx  context.Context
+	page *PageReader
+}
+
+func (r *ctxPageReader) Read(p []byte) (int, error) {
+	return r.page.ReadContext(r.ctx, p)
+}
+
 //NewPageReader converts data buffer to image object
-func NewPageReader(session *ScanSession, param *ScanParameters) *PageReader {
+func NewPageReader(session Session, param *ScanParameters) *PageReader {
 
 	b := PageReader{
-		Width:   param.Width(),
-		Height:  param.Height(),
-		Format:  param.ImageFormat(),
-		Session: session,
+		Width:     param.Width(),
+		Height:    param.Height(),
+		Format:    param.ImageFormat(),
+		Session:   session,
+		imageSize: uint64(param.ImageSize()),
 	}
 
 	return &b
@@ -0,0 +1,190 @@
+package lisgo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		name string
+		//read is the count of bytes read from every page, -1 reads the image
+		read []int
+	}{
+		{"images", []int{-1, -1, -1}},
+		{"unread pages", []int{0, 0, -1}},
+		{"partly read page", []int{-1, 100, -1}},
+		{"partly read header", []int{10, 20, -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, release := testSource(t, "feeder")
+			defer release()
+			width, height := setTestArea(t, ps, FakeModeGray)
+			session, err := ps.ScanStart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+
+			ctx := context.Background()
+			for k, n := range tt.read {
+				page, err := session.NextPage(ctx)
+				if err != nil {
+					t.Fatalf("page %d: %v", k, err)
+				}
+				if page.Index != k {
+					t.Errorf("page %d has index %d", k, page.Index)
+				}
+				if n >= 0 {
+					if _, err = io.ReadFull(page, make([]byte, n)); err != nil {
+						t.Fatalf("page %d: %v", k, err)
+					}
+					continue
+				}
+				img, err := page.GetImage()
+				if err != nil {
+					t.Fatalf("page %d: %v", k, err)
+				}
+				//the pattern tells which page it is
+				for _, x := range []int{0, width / 2, width - 1} {
+					if got, want := img.At(x, 0), fakePixel(FakeModeGray, k, x, 0, width, height, 75); !sameColor(got, want) {
+						t.Errorf("page %d: pixel (%d, 0) is %v, want %v", k, x, got, want)
+					}
+				}
+			}
+			for k := 0; k < 2; k++ {
+				if page, err := session.NextPage(ctx); err != io.EOF {
+					t.Fatalf("got %v, %v after the last page, want io.EOF", page, err)
+				}
+			}
+		})
+	}
+}
+
+//readPages reads every page of the feeder with read
+func readPages(t *testing.T, bufferSize int, read func(page *PageReader) ([]byte, error)) [][]byte {
+	t.Helper()
+	ps, release := testSource(t, "feeder")
+	defer release()
+	setTestArea(t, ps, FakeModeColor)
+	session, err := ps.ScanStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err = session.SetBufferSize(bufferSize); err != nil {
+		t.Fatal(err)
+	}
+	var pages [][]byte
+	for {
+		page, err := session.NextPage(context.Background())
+		if err == io.EOF {
+			return pages
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := read(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, data)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	readAll := func(page *PageReader) ([]byte, error) {
+		return ioutil.ReadAll(page)
+	}
+	writeTo := func(page *PageReader) ([]byte, error) {
+		var buf bytes.Buffer
+		n, err := page.WriteTo(&buf)
+		if err == nil && n != int64(buf.Len()) {
+			t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+		}
+		return buf.Bytes(), err
+	}
+	for _, size := range []int{ScanSessionCBufferSize, 1000, 7} {
+		want := readPages(t, size, readAll)
+		got := readPages(t, size, writeTo)
+		if len(want) != 3 || len(got) != len(want) {
+			t.Fatalf("buffer %d: read %d pages, written %d", size, len(want), len(got))
+		}
+		for k := range want {
+			if len(want[k]) == 0 || !bytes.Equal(got[k], want[k]) {
+				t.Errorf("buffer %d: page %d: written %d bytes, read %d", size, k, len(got[k]), len(want[k]))
+			}
+		}
+	}
+}
+
+func TestSetBufferSize(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+	session, err := ps.ScanStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	tests := []struct {
+		size int
+		ok   bool
+	}{
+		{1, true},
+		{ScanSessionMaxBufferSize, true},
+		{0, false},
+		{-1, false},
+		{ScanSessionMaxBufferSize + 1, false},
+	}
+	for _, tt := range tests {
+		err := session.SetBufferSize(tt.size)
+		if (err == nil) != tt.ok {
+			t.Errorf("SetBufferSize(%d): %v", tt.size, err)
+		}
+		if err == nil && session.BufferSize() != tt.size {
+			t.Errorf("BufferSize() is %d, want %d", session.BufferSize(), tt.size)
+		}
+	}
+}
+
+func TestReadContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    error
+	}{
+		{"in time", time.Second, nil},
+		{"deadline", 20 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, release := slowSource(t, 100*time.Millisecond)
+			defer release()
+			session, err := ps.ScanStart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+			page, err := session.NextPage(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			n, err := page.ReadContext(ctx, make([]byte, 1024))
+			if err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && n != 1024 {
+				t.Errorf("got %d bytes, want 1024", n)
+			}
+		})
+	}
+}
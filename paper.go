@@ -0,0 +1,146 @@
+package lisgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+//Orientation of the paper
+type Orientation int
+
+//Portrait has the long side vertical, Landscape has it horizontal
+const (
+	Portrait Orientation = iota
+	Landscape
+)
+
+func (o Orientation) String() string {
+	if o == Landscape {
+		return "landscape"
+	}
+	return "portrait"
+}
+
+//PaperSize is a preset of the scan area in millimeters. Zero Height means the full length of the scan area (receipts).
+type PaperSize struct {
+	Name   string
+	Width  float64
+	Height float64
+}
+
+var paperSizes = []PaperSize{
+	{Name: "A3", Width: 297, Height: 420},
+	{Name: "A4", Width: 210, Height: 297},
+	{Name: "A5", Width: 148, Height: 210},
+	{Name: "A6", Width: 105, Height: 148},
+	{Name: "Letter", Width: 215.9, Height: 279.4},
+	{Name: "Legal", Width: 215.9, Height: 355.6},
+	{Name: "BusinessCard", Width: 50.8, Height: 88.9},
+	{Name: "ID-1", Width: 53.98, Height: 85.6},
+	{Name: "Receipt58", Width: 58},
+	{Name: "Receipt80", Width: 80},
+}
+
+//PaperSizes returns all known paper sizes
+func PaperSizes() []PaperSize {
+	res := make([]PaperSize, len(paperSizes))
+	copy(res, paperSizes)
+	return res
+}
+
+//LookupPaperSize finds the paper size by name, case insensitive
+func LookupPaperSize(name string) (PaperSize, bool) {
+	for _, p := range paperSizes {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return PaperSize{}, false
+}
+
+//Oriented returns the size with the long side along the orientation. Zero Height stays along the length of the scan area.
+func (p PaperSize) Oriented(o Orientation) PaperSize {
+	if p.Height == 0 {
+		if o == Landscape {
+			p.Width, p.Height = 0, p.Width
+		}
+		return p
+	}
+	if (o == Landscape) != (p.Width > p.Height) {
+		p.Width, p.Height = p.Height, p.Width
+	}
+	return p
+}
+
+//SetPaperSize sets the scan area to the paper size at the top-left corner of the scanner.
+//The area is clamped to the ranges of the tl-x, tl-y, br-x and br-y options.
+func (s *PaperSource) SetPaperSize(name string, orientation Orientation) error {
+	p, ok := LookupPaperSize(name)
+	if !ok {
+		names := make([]string, len(paperSizes))
+		for k, ps := range paperSizes {
+			names[k] = ps.Name
+		}
+		return newError(LisErrInvalidValue, "SetPaperSize", fmt.Sprintf("unknown paper size '%s', known sizes: %s", name, strings.Join(names, ", ")))
+	}
+	p = p.Oriented(orientation)
+	left, _, err := s.areaLimits(OptionTLX)
+	if err != nil {
+		return err
+	}
+	top, _, err := s.areaLimits(OptionTLY)
+	if err != nil {
+		return err
+	}
+	_, right, err := s.areaLimits(OptionBRX)
+	if err != nil {
+		return err
+	}
+	_, bottom, err := s.areaLimits(OptionBRY)
+	if err != nil {
+		return err
+	}
+	r := Rect{Left: left, Top: top, Right: right, Bottom: bottom}
+	if math.IsInf(right, 1) || math.IsInf(bottom, 1) {
+		//no limit for the full length, keep the current one
+		current, err := s.ScanArea(LengthMM)
+		if err != nil {
+			return err
+		}
+		r.Right, r.Bottom = math.Min(right, current.Right), math.Min(bottom, current.Bottom)
+	}
+	if p.Width > 0 {
+		r.Right = math.Min(left+p.Width, right)
+	}
+	if p.Height > 0 {
+		r.Bottom = math.Min(top+p.Height, bottom)
+	}
+	return s.SetScanArea(r, LengthMM)
+}
+
+//areaLimits returns the range of the area option in millimeters, unbounded if the option has no range
+func (s *PaperSource) areaLimits(name string) (float64, float64, error) {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	if opt.Constraint == nil || opt.Constraint.ConstraintType != LisConstraintRange || opt.Constraint.PossibleRange == nil {
+		return 0, math.Inf(1), nil
+	}
+	unit, err := s.areaUnit(opt)
+	if err != nil {
+		return 0, 0, err
+	}
+	r := opt.Constraint.PossibleRange
+	limits := [2]float64{r.MinValue.DoubleValue, r.MaxValue.DoubleValue}
+	if opt.ValueType == LisTypeInteger {
+		limits = [2]float64{float64(r.MinValue.IntValue), float64(r.MaxValue.IntValue)}
+	}
+	for k := range limits {
+		if limits[k], err = s.convertLength(limits[k], unit, LengthMM); err != nil {
+			return 0, 0, err
+		}
+	}
+	return limits[0], limits[1], nil
+}
@@ -0,0 +1,103 @@
+package lisgo
+
+import (
+	"testing"
+)
+
+func TestOriented(t *testing.T) {
+	tests := []struct {
+		size        PaperSize
+		orientation Orientation
+		width       float64
+		height      float64
+	}{
+		{PaperSize{Width: 210, Height: 297}, Portrait, 210, 297},
+		{PaperSize{Width: 210, Height: 297}, Landscape, 297, 210},
+		{PaperSize{Width: 297, Height: 210}, Portrait, 210, 297},
+		{PaperSize{Width: 58}, Portrait, 58, 0},
+		{PaperSize{Width: 58}, Landscape, 0, 58},
+	}
+	for _, tt := range tests {
+		if got := tt.size.Oriented(tt.orientation); got.Width != tt.width || got.Height != tt.height {
+			t.Errorf("%+v %s is %vx%v, want %vx%v", tt.size, tt.orientation, got.Width, got.Height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestSetPaperSize(t *testing.T) {
+	//the flatbed is 215.9x297 mm
+	tests := []struct {
+		name        string
+		orientation Orientation
+		want        Rect
+	}{
+		{"A4", Portrait, Rect{Right: 210, Bottom: 297}},
+		{"a5", Portrait, Rect{Right: 148, Bottom: 210}},
+		{"A4", Landscape, Rect{Right: 215.9, Bottom: 210}},
+		{"A3", Portrait, Rect{Right: 215.9, Bottom: 297}},
+		{"Letter", Landscape, Rect{Right: 215.9, Bottom: 215.9}},
+		{"Legal", Portrait, Rect{Right: 215.9, Bottom: 297}},
+		{"Receipt80", Portrait, Rect{Right: 80, Bottom: 297}},
+		{"Receipt58", Landscape, Rect{Right: 215.9, Bottom: 58}},
+	}
+	ps, release := testSource(t, "flatbed")
+	defer release()
+	for _, tt := range tests {
+		if err := ps.SetPaperSize(tt.name, tt.orientation); err != nil {
+			t.Fatalf("SetPaperSize(%s, %s): %v", tt.name, tt.orientation, err)
+		}
+		got, err := ps.ScanArea(LengthMM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameRect(got, tt.want) {
+			t.Errorf("%s %s: got %+v, want %+v", tt.name, tt.orientation, got, tt.want)
+		}
+	}
+
+	if err := ps.SetPaperSize("A0", Portrait); err == nil {
+		t.Error("SetPaperSize(A0) succeeded")
+	}
+}
+
+//TestSetPaperSizeLimits is a scanner which can't reach the left edge and has no limit of the length
+func TestSetPaperSizeLimits(t *testing.T) {
+	cfg := DefaultFakeConfig()
+	opts := DefaultFakeOptions()
+	for _, o := range opts {
+		switch o.Name {
+		case OptionTLX:
+			o.Constraint.PossibleRange.MinValue.DoubleValue = 5
+			o.Value.DoubleValue = 5
+		case OptionBRY:
+			o.Constraint = nil
+			o.Value.DoubleValue = 500
+		}
+	}
+	cfg.Devices[0].Sources[0].Options = opts
+	ps, release := testSourceWith(t, cfg, "flatbed")
+	defer release()
+
+	tests := []struct {
+		name        string
+		orientation Orientation
+		want        Rect
+	}{
+		{"A4", Portrait, Rect{Left: 5, Right: 215, Bottom: 297}},
+		{"A4", Landscape, Rect{Left: 5, Right: 215.9, Bottom: 210}},
+		//the length is kept
+		{"Receipt80", Portrait, Rect{Left: 5, Right: 85, Bottom: 210}},
+	}
+	for _, tt := range tests {
+		if err := ps.SetPaperSize(tt.name, tt.orientation); err != nil {
+			t.Fatalf("SetPaperSize(%s, %s): %v", tt.name, tt.orientation, err)
+		}
+		got, err := ps.ScanArea(LengthMM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameRect(got, tt.want) {
+			t.Errorf("%s %s: got %+v, want %+v", tt.name, tt.orientation, got, tt.want)
+		}
+	}
+}
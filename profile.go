@@ -0,0 +1,191 @@
+package lisgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	//Profile is a snapshot of option values of a paper source, it can be saved as JSON or YAML
+	Profile struct {
+		//Source is the name of the paper source the profile was taken from
+		Source  string          `json:"source,omitempty" yaml:"source,omitempty"`
+		Options []ProfileOption `json:"options" yaml:"options"`
+	}
+
+	//ProfileOption is a single option of a profile
+	ProfileOption struct {
+		Name string    `json:"name" yaml:"name"`
+		Type ValueType `json:"type" yaml:"type"`
+		//Value is the string representation accepted by SetOption
+		Value string `json:"value" yaml:"value"`
+	}
+
+	//ApplyReport tells which options of a profile have been applied
+	ApplyReport struct {
+		Applied []string
+		//Failed holds the last error for every option which couldn't be set
+		Failed map[string]error
+	}
+)
+
+//profileOrder ranks options which change the others (and their constraints) first, the scan area last.
+//Options of the same rank keep the order of the profile.
+var profileOrder = map[string]int{
+	OptionSource:     0,
+	OptionMode:       1,
+	"depth":          1,
+	OptionUnits:      1,
+	OptionDuplex:     1,
+	OptionResolution: 2,
+	OptionTLX:        4,
+	OptionTLY:        4,
+	OptionBRX:        4,
+	OptionBRY:        4,
+}
+
+const profileDefaultRank = 3
+
+//ExportOptions snapshots every readable and writable option of the paper source. Options of the canonical vocabulary
+//(mode, duplex, page size) are saved with canonical names and values, so the profile works with other drivers.
+func (s *PaperSource) ExportOptions() (*Profile, error) {
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	p := Profile{Source: s.Name}
+	for _, o := range opts {
+		if !o.IsReadable() || !o.IsWritable() || o.ValueType == LisTypeImageFormat {
+			continue
+		}
+		v, err := o.GetValue()
+		if err != nil {
+			return nil, err
+		}
+		cv := o.CanonicalValue(*v)
+		p.Options = append(p.Options, ProfileOption{Name: o.CanonicalName(), Type: o.ValueType, Value: cv.String()})
+	}
+	return &p, nil
+}
+
+//ApplyProfile sets options of the profile. Options which change the others go first, the scan area goes last.
+//Options which fail are retried while the others succeed, since setting one option may activate another or
+//widen its constraint. The returned error is about the source itself, failures of options are in the report.
+func (s *PaperSource) ApplyProfile(p *Profile) (*ApplyReport, error) {
+	if _, err := s.options(); err != nil {
+		return nil, err
+	}
+	pending := make([]ProfileOption, len(p.Options))
+	copy(pending, p.Options)
+	sort.SliceStable(pending, func(i, j int) bool {
+		return profileRank(pending[i].Name) < profileRank(pending[j].Name)
+	})
+
+	report := ApplyReport{Failed: make(map[string]error)}
+	for len(pending) > 0 {
+		var failed []ProfileOption
+		for _, po := range pending {
+			if err := s.applyProfileOption(po); err != nil {
+				report.Failed[po.Name] = err
+				failed = append(failed, po)
+				continue
+			}
+			delete(report.Failed, po.Name)
+			report.Applied = append(report.Applied, po.Name)
+		}
+		if len(failed) == len(pending) {
+			//no progress, nothing is going to change
+			break
+		}
+		pending = failed
+	}
+	return &report, nil
+}
+
+func (s *PaperSource) applyProfileOption(po ProfileOption) error {
+	o, err := s.CanonicalOption(po.Name)
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		return newError(LisErrInvalidValue, "ApplyProfile", fmt.Sprintf("option '%s' not found", po.Name))
+	}
+	if o.ValueType != po.Type {
+		return newError(LisErrInvalidValue, "ApplyProfile", fmt.Sprintf("option '%s' is of type %s, not %s", po.Name, o.ValueType, po.Type))
+	}
+	_, err = s.setCanonical(o, po.Value)
+	return err
+}
+
+func profileRank(name string) int {
+	if rank, ok := profileOrder[CanonicalOptionName(name)]; ok {
+		return rank
+	}
+	return profileDefaultRank
+}
+
+//SaveProfile writes the profile to a file, as YAML if the extension is .yaml or .yml and as JSON otherwise
+func SaveProfile(name string, p *Profile) error {
+	var data []byte
+	var err error
+	if isYaml(name) {
+		data, err = yaml.Marshal(p)
+	} else {
+		data, err = json.MarshalIndent(p, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+//LoadProfile reads the profile saved by SaveProfile
+func LoadProfile(name string) (*Profile, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if isYaml(name) {
+		err = yaml.Unmarshal(data, &p)
+	} else {
+		err = json.Unmarshal(data, &p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse profile '%s': %v", name, err)
+	}
+	return &p, nil
+}
+
+func isYaml(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+//MarshalText writes the type by name, so profiles are readable
+func (t ValueType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+//UnmarshalText accepts the name of the type
+func (t *ValueType) UnmarshalText(text []byte) error {
+	for k, v := range lisTypeNames {
+		if v == string(text) {
+			*t = k
+			return nil
+		}
+	}
+	//String of an unknown type
+	var n uint32
+	if _, err := fmt.Sscanf(string(text), "ValueType(%d)", &n); err == nil {
+		*t = ValueType(n)
+		return nil
+	}
+	return fmt.Errorf("unknown value type '%s'", text)
+}
@@ -0,0 +1,179 @@
+package lisgo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//optionString returns the current value of the option as SetOption accepts it
+func optionString(t *testing.T, ps *PaperSource, name string) string {
+	t.Helper()
+	o, err := ps.Option(name)
+	if err != nil || o == nil {
+		t.Fatalf("Option(%s): %v, %v", name, o, err)
+	}
+	v, err := o.GetValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v.String()
+}
+
+func TestProfileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lisgo-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	values := map[string]string{
+		OptionResolution: "300",
+		OptionMode:       FakeModeGray,
+		"brightness":     "20",
+		OptionBRX:        "100.5",
+	}
+	src, release := testSource(t, "flatbed")
+	defer release()
+	for name, val := range values {
+		if _, err = src.SetOption(name, val); err != nil {
+			t.Fatalf("SetOption(%s, %s): %v", name, val, err)
+		}
+	}
+	exported, err := src.ExportOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported.Source != "flatbed" || len(exported.Options) != 7 {
+		t.Fatalf("unexpected profile %+v", exported)
+	}
+
+	for _, file := range []string{"profile.json", "profile.yaml", "profile.yml"} {
+		t.Run(file, func(t *testing.T) {
+			name := filepath.Join(dir, file)
+			if err := SaveProfile(name, exported); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadProfile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded, exported) {
+				t.Fatalf("loaded %+v, saved %+v", loaded, exported)
+			}
+
+			//a new API instance starts with the default values
+			dst, release := testSource(t, "flatbed")
+			defer release()
+			report, err := dst.ApplyProfile(loaded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Failed) != 0 || len(report.Applied) != len(loaded.Options) {
+				t.Fatalf("applied %v, failed %v", report.Applied, report.Failed)
+			}
+			for name := range values {
+				if got, want := optionString(t, dst, name), optionString(t, src, name); got != want {
+					t.Errorf("%s is %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadProfileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lisgo-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		file string
+		data string
+	}{
+		{"type.json", `{"options": [{"name": "mode", "type": "complex", "value": "x"}]}`},
+		{"syntax.json", `{"options": [`},
+		{"type.yaml", "options:\n- name: mode\n  type: complex\n  value: x\n"},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(dir, tt.file)
+		if err = ioutil.WriteFile(name, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := LoadProfile(name); err == nil {
+			t.Errorf("%s: got %+v, want an error", tt.file, p)
+		}
+	}
+	if _, err = LoadProfile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file: want an error")
+	}
+}
+
+func TestValueTypeText(t *testing.T) {
+	for _, vt := range []ValueType{LisTypeBool, LisTypeInteger, LisTypeDouble, LisTypeString, LisTypeImageFormat, ValueType(42)} {
+		text, err := vt.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got ValueType
+		if err = got.UnmarshalText(text); err != nil || got != vt {
+			t.Errorf("%s: got %v, %v", text, got, err)
+		}
+	}
+}
+
+func TestProfileRank(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{OptionSource, 0},
+		{OptionMode, 1},
+		{"scan_mode", 1},
+		{OptionResolution, 2},
+		{"brightness", profileDefaultRank},
+		{OptionTLX, 4},
+		{OptionBRY, 4},
+	}
+	for _, tt := range tests {
+		if got := profileRank(tt.name); got != tt.want {
+			t.Errorf("profileRank(%s) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyProfileOrder(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+
+	p := &Profile{Options: []ProfileOption{
+		{Name: OptionBRX, Type: LisTypeDouble, Value: "50"},
+		{Name: "missing", Type: LisTypeInteger, Value: "1"},
+		{Name: OptionTLX, Type: LisTypeDouble, Value: "10"},
+		{Name: OptionTLY, Type: LisTypeDouble, Value: "1000"},
+		{Name: "brightness", Type: LisTypeInteger, Value: "-20"},
+		{Name: OptionResolution, Type: LisTypeInteger, Value: "600"},
+		{Name: OptionMode, Type: LisTypeString, Value: FakeModeGray},
+	}}
+	report, err := ps.ApplyProfile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//sorted by rank, the profile order is kept within a rank
+	want := []string{OptionMode, OptionResolution, "brightness", OptionBRX, OptionTLX}
+	if !reflect.DeepEqual(report.Applied, want) {
+		t.Errorf("applied %v, want %v", report.Applied, want)
+	}
+	//failed options are retried until nothing changes
+	if len(report.Failed) != 2 || report.Failed["missing"] == nil || report.Failed[OptionTLY] == nil {
+		t.Errorf("failed %v, want missing and %s", report.Failed, OptionTLY)
+	}
+	for name, want := range map[string]string{OptionResolution: "600", OptionMode: FakeModeGray, "brightness": "-20", OptionTLX: "10"} {
+		if got := optionString(t, ps, name); got != want {
+			t.Errorf("%s is %s, want %s", name, got, want)
+		}
+	}
+}
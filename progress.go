@@ -0,0 +1,67 @@
+package lisgo
+
+import "time"
+
+//Progress of reading a page, see ScanSession.SetProgress and PageReader.OnProgress
+type Progress struct {
+	//Page is the index of the page in the scan session starting from 0
+	Page int
+	//BytesRead is the count of bytes received from the driver
+	BytesRead uint64
+	//EstimatedTotal is ScanParameters.ImageSize, it's not guaranteed to be true. 0 if unknown.
+	EstimatedTotal uint64
+	//EstimatedLines is BytesRead scaled to the image height: the data isn't decoded, so headers and
+	//row padding are counted as lines. It's the image height in the last report.
+	EstimatedLines int
+	//Elapsed is the time since the first read of the page
+	Elapsed time.Duration
+	//BytesPerSecond is the average throughput of the page
+	BytesPerSecond float64
+	//Done is set in the last report of the page
+	Done bool
+}
+
+//Percent of the estimated total, 0 if it's unknown
+func (p Progress) Percent() float64 {
+	if p.EstimatedTotal == 0 {
+		return 0
+	}
+	percent := float64(p.BytesRead) * 100 / float64(p.EstimatedTotal)
+	if percent > 100 || p.Done {
+		percent = 100
+	}
+	return percent
+}
+
+//SetProgress sets the callback called by the pages returned by NextPage after every chunk read from the driver
+func (s *ScanSession) SetProgress(f func(Progress)) {
+	s.progress = f
+}
+
+//reportProgress counts the bytes received and calls OnProgress if it's set
+func (sb *PageReader) reportProgress(got uint64, done bool) {
+	sb.bytesRead += got
+	if sb.OnProgress == nil {
+		return
+	}
+	now := time.Now()
+	p := Progress{
+		Page:           sb.Index,
+		BytesRead:      sb.bytesRead,
+		EstimatedTotal: sb.imageSize,
+		Done:           done,
+	}
+	if !sb.started.IsZero() {
+		p.Elapsed = now.Sub(sb.started)
+	}
+	if sb.imageSize > 0 && sb.Height > 0 {
+		p.EstimatedLines = int(p.BytesRead * uint64(sb.Height) / sb.imageSize)
+		if p.EstimatedLines > sb.Height || done {
+			p.EstimatedLines = sb.Height
+		}
+	}
+	if p.Elapsed > 0 {
+		p.BytesPerSecond = float64(p.BytesRead) / p.Elapsed.Seconds()
+	}
+	sb.OnProgress(p)
+}
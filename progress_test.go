@@ -0,0 +1,122 @@
+package lisgo
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(page *PageReader) (int, error) //-1 if the page isn't read
+	}{
+		{"read", func(page *PageReader) (int, error) {
+			data, err := ioutil.ReadAll(page)
+			return len(data), err
+		}},
+		{"write to", func(page *PageReader) (int, error) {
+			n, err := page.WriteTo(ioutil.Discard)
+			return int(n), err
+		}},
+		{"skip", func(page *PageReader) (int, error) {
+			return -1, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, release := testSource(t, "feeder")
+			defer release()
+			_, height := setTestArea(t, ps, FakeModeGray)
+			session, err := ps.ScanStart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+			if err = session.SetBufferSize(1000); err != nil {
+				t.Fatal(err)
+			}
+			var reports []Progress
+			session.SetProgress(func(p Progress) {
+				reports = append(reports, p)
+			})
+
+			var sizes []int
+			for {
+				page, err := session.NextPage(context.Background())
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				n, err := tt.read(page)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sizes = append(sizes, n)
+			}
+			if len(sizes) != 3 {
+				t.Fatalf("got %d pages, want 3", len(sizes))
+			}
+
+			//a page is many chunks of the buffer size
+			if len(reports) < 10*len(sizes) {
+				t.Fatalf("got %d reports of %d pages", len(reports), len(sizes))
+			}
+			var last Progress
+			page := 0
+			for k, p := range reports {
+				if k > 0 && last.Done {
+					page++
+					last = Progress{}
+				}
+				if p.Page != page {
+					t.Fatalf("report %d is of page %d, want %d", k, p.Page, page)
+				}
+				if p.BytesRead < last.BytesRead || p.EstimatedLines < last.EstimatedLines {
+					t.Errorf("page %d: %d bytes, %d lines reported after %d bytes, %d lines",
+						page, p.BytesRead, p.EstimatedLines, last.BytesRead, last.EstimatedLines)
+				}
+				if p.EstimatedLines > height || p.EstimatedTotal == 0 {
+					t.Errorf("page %d: %d lines, estimated total %d", page, p.EstimatedLines, p.EstimatedTotal)
+				}
+				if p.Done {
+					if p.EstimatedLines != height || p.Percent() != 100 {
+						t.Errorf("page %d is done at %d lines, %v%%, want %d lines", page, p.EstimatedLines, p.Percent(), height)
+					}
+					if sizes[page] >= 0 && p.BytesRead != uint64(sizes[page]) {
+						t.Errorf("page %d is done at %d bytes, %d read", page, p.BytesRead, sizes[page])
+					}
+				}
+				last = p
+			}
+			if page != 2 || !last.Done {
+				t.Errorf("the last report is %+v", last)
+			}
+		})
+	}
+}
+
+func TestBytesReadWithoutProgress(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+	setTestArea(t, ps, FakeModeColor)
+	session, err := ps.ScanStart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	page, err := session.NextPage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.bytesRead != uint64(len(data)) {
+		t.Errorf("counted %d bytes, read %d", page.bytesRead, len(data))
+	}
+}
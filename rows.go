@@ -0,0 +1,136 @@
+package lisgo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//PixelFormat is the layout of a row passed by PageReader.Rows
+type PixelFormat int
+
+//pixel formats of rows
+const (
+	//PixelBW1 is 1 bit per pixel, the leftmost pixel is the most significant bit, 1 is white
+	PixelBW1 PixelFormat = iota
+	//PixelGray8 is 1 byte per pixel, 255 is white
+	PixelGray8
+	//PixelRGB24 is 3 bytes per pixel: red, green, blue
+	PixelRGB24
+)
+
+var pixelFormatNames = map[PixelFormat]string{
+	PixelBW1:   "BW1",
+	PixelGray8: "Gray8",
+	PixelRGB24: "RGB24",
+}
+
+func (f PixelFormat) String() string {
+	if name, ok := pixelFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("PixelFormat(%d)", int(f))
+}
+
+//RowBytes returns the length of a row of width pixels
+func (f PixelFormat) RowBytes(width int) int {
+	switch f {
+	case PixelBW1:
+		return (width + 7) / 8
+	case PixelRGB24:
+		return width * 3
+	}
+	return width
+}
+
+//Rows decodes the page row by row as the data arrive from the driver, without holding the whole image.
+//y is the row index from the top of the image. Bottom-up BMPs (the usual ones) are decoded in the order they
+//are sent: from the last row (y = Height-1) to the first one. row is without the BMP padding and is valid
+//only until f returns. Rows stops and returns the error of f. 1-bit rows are shifted like GetImage does,
+//so both give the same pixels.
+func (sb *PageReader) Rows(f func(y int, row []byte, format PixelFormat) error) error {
+	return sb.RowsContext(context.Background(), f)
+}
+
+//RowsContext is Rows which gives up and cancels the scan session when ctx ends
+func (sb *PageReader) RowsContext(ctx context.Context, f func(y int, row []byte, format PixelFormat) error) error {
+	r := &ctxPageReader{ctx: ctx, page: sb}
+
+	header, buf, err := ReadBMPHeader(r)
+	if err != nil {
+		return err
+	}
+	//headers newer than version 3 are longer, skip them up to the pixel data
+	if skip := int64(header.OffsetToData) - int64(len(buf)); skip > 0 {
+		if _, err = io.CopyN(ioutil.Discard, r, skip); err != nil {
+			return err
+		}
+	}
+	if header.Compression != 0 {
+		return newError(LisErrUnsupported, "Rows", fmt.Sprintf("BMP compression %d", header.Compression))
+	}
+
+	var format PixelFormat
+	switch header.NbBitsPerPixel {
+	case 1:
+		format = PixelBW1
+	case 8:
+		format = PixelGray8
+	case 24:
+		format = PixelRGB24
+	default:
+		return newError(LisErrUnsupported, "Rows", fmt.Sprintf("BMP with %d bits per pixel", header.NbBitsPerPixel))
+	}
+
+	width := int(header.Width)
+	height := int(abs(header.Height))
+	rowBytes := format.RowBytes(width)
+	line := make([]byte, pad4(uint32(rowBytes)))
+	row := line[:rowBytes]
+	var shifted []byte
+	if format == PixelBW1 {
+		shifted = make([]byte, rowBytes)
+	}
+	for k := 0; k < height; k++ {
+		if _, err = io.ReadFull(r, line); err != nil {
+			return err
+		}
+		y := k
+		if header.Height > 0 {
+			//bottom-up image
+			y = height - k - 1
+		}
+		out := row
+		switch format {
+		case PixelRGB24:
+			//BMP stores BGR
+			for x := 0; x < rowBytes; x += 3 {
+				row[x], row[x+2] = row[x+2], row[x]
+			}
+		case PixelBW1:
+			rotateBits(shifted, row, width, bmpBwShift)
+			out = shifted
+		}
+		if err = f(y, out, format); err != nil {
+			return err
+		}
+	}
+	return sb.drain(ctx)
+}
+
+//rotateBits writes the row of width 1-bit pixels to dst, the pixel x of dst is the pixel (x+shift)%width of src
+func rotateBits(dst []byte, src []byte, width int, shift int) {
+	for k := range dst {
+		dst[k] = 0
+	}
+	if width == 0 {
+		return
+	}
+	for x := 0; x < width; x++ {
+		sx := (x + shift) % width
+		if src[sx/8]&(0x80>>uint(sx%8)) != 0 {
+			dst[x/8] |= 0x80 >> uint(x%8)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package lisgo
+
+import (
+	"context"
+	"image/color"
+	"testing"
+)
+
+//rowPixel is the pixel x of the row passed by Rows
+func rowPixel(row []byte, format PixelFormat, x int) color.Color {
+	switch format {
+	case PixelBW1:
+		if row[x/8]&(0x80>>uint(x%8)) != 0 {
+			return color.Gray{Y: 255}
+		}
+		return color.Gray{Y: 0}
+	case PixelGray8:
+		return color.Gray{Y: row[x]}
+	}
+	return color.RGBA{R: row[3*x], G: row[3*x+1], B: row[3*x+2], A: 255}
+}
+
+func TestRows(t *testing.T) {
+	tests := []struct {
+		mode   string
+		format PixelFormat
+	}{
+		{FakeModeLineArt, PixelBW1},
+		{FakeModeGray, PixelGray8},
+		{FakeModeColor, PixelRGB24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			img, width, height := scanTestImage(t, "flatbed", tt.mode)
+
+			ps, release := testSource(t, "flatbed")
+			defer release()
+			setTestArea(t, ps, tt.mode)
+			session, err := ps.ScanStart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+			page, err := session.NextPage(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			//bottom-up BMPs come from the last row
+			next := height - 1
+			err = page.Rows(func(y int, row []byte, format PixelFormat) error {
+				if y != next {
+					t.Fatalf("got row %d, want %d", y, next)
+				}
+				next--
+				if format != tt.format || len(row) != format.RowBytes(width) {
+					t.Fatalf("row %d is %s of %d bytes, want %s of %d", y, format, len(row), tt.format, tt.format.RowBytes(width))
+				}
+				for x := 0; x < width; x++ {
+					if got, want := rowPixel(row, format, x), img.At(x, y); !sameColor(got, want) {
+						t.Fatalf("pixel (%d, %d) is %v, GetImage has %v", x, y, got, want)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next != -1 {
+				t.Errorf("rows %d..0 are missing", next)
+			}
+		})
+	}
+}
+
+func TestRotateBits(t *testing.T) {
+	tests := []struct {
+		src   []byte
+		width int
+		shift int
+		want  []byte
+	}{
+		{[]byte{0x80, 0x00}, 16, 0, []byte{0x80, 0x00}},
+		{[]byte{0x80, 0x00}, 16, 1, []byte{0x00, 0x01}},
+		{[]byte{0x12, 0x34}, 16, 8, []byte{0x34, 0x12}},
+		{[]byte{0x12, 0x34}, 16, 64, []byte{0x12, 0x34}},
+		//the padding bits of the last byte are not pixels
+		{[]byte{0xc0, 0x3f}, 10, 2, []byte{0x00, 0xc0}},
+		{[]byte{0xa0}, 3, 1, []byte{0x60}},
+	}
+	for _, tt := range tests {
+		got := make([]byte, len(tt.src))
+		rotateBits(got, tt.src, tt.width, tt.shift)
+		if string(got) != string(tt.want) {
+			t.Errorf("rotateBits(%x, %d, %d) = %x, want %x", tt.src, tt.width, tt.shift, got, tt.want)
+		}
+	}
+}
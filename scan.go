@@ -0,0 +1,180 @@
+package lisgo
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"sort"
+
+	"github.com/apex/log"
+)
+
+type (
+	//Request describes what Scan should do
+	Request struct {
+		//Device is DeviceID of the scanner
+		Device string
+		//Source is the name of the paper source
+		Source string
+		//Profile is applied first if not nil, options which cannot be set are logged and skipped
+		Profile *Profile
+		//Paper is the name of a paper size (see PaperSizes) to set the scan area to, after the profile
+		Paper       string
+		Orientation Orientation
+		//Options are set last, see PaperSource.SetOption
+		Options map[string]string
+		//Nearest snaps Options to the nearest legal values, see PaperSource.SetOptionNearest
+		Nearest bool
+		//Progress is called while pages are read, see ScanSession.SetProgress
+		Progress func(Progress)
+		//BufferSize is the read buffer size of the session, ScanSessionCBufferSize if 0. See ScanSession.SetBufferSize.
+		BufferSize int
+	}
+
+	//Page is a decoded page passed to a PageSink
+	Page struct {
+		//Index of the page in the scan session starting from 0
+		Index int
+		Image image.Image
+		//Format is the format the driver has sent the page in
+		Format ImageFormat
+		//Resolution in DPI, 0 if unknown
+		Resolution int
+	}
+
+	//PageSink receives the pages scanned by Scan. Close is called once when the scan is over, even if it has failed.
+	PageSink interface {
+		WritePage(ctx context.Context, page *Page) error
+		io.Closer
+	}
+)
+
+//Scan opens the device, sets the options of the paper source and passes every scanned page to the sink.
+//It creates and releases an API instance, see (*lisgo).Scan to reuse one.
+func Scan(ctx context.Context, req Request, sink PageSink) error {
+	lis, err := New()
+	if err != nil {
+		sink.Close()
+		return err
+	}
+	defer lis.Close()
+	return lis.Scan(ctx, req, sink)
+}
+
+//Scan is the package level Scan using this API instance
+func (o *lisgo) Scan(ctx context.Context, req Request, sink PageSink) (err error) {
+	defer func() {
+		if cerr := sink.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	dev, err := o.GetDevice(req.Device)
+	if err != nil {
+		return err
+	}
+	if dev == nil {
+		return newError(LisErrInvalidValue, "Scan", fmt.Sprintf("device '%s' not found", req.Device))
+	}
+	if err = dev.Open(); err != nil {
+		return err
+	}
+	defer dev.Close()
+
+	ps, err := dev.GetPaperSource(req.Source)
+	if err != nil {
+		return err
+	}
+	if ps == nil {
+		return newError(LisErrInvalidValue, "Scan", fmt.Sprintf("paper source '%s' not found", req.Source))
+	}
+	if err = ps.prepare(&req); err != nil {
+		return err
+	}
+	dpi, err := ps.Resolution()
+	if err != nil {
+		log.WithError(err).Debug("cannot get resolution")
+		dpi = 0
+	}
+
+	session, err := ps.ScanStartContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.SetProgress(req.Progress)
+	if req.BufferSize != 0 {
+		if err = session.SetBufferSize(req.BufferSize); err != nil {
+			return err
+		}
+	}
+	for {
+		page, err := session.NextPage(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		img, err := page.GetImageContext(ctx)
+		if err != nil {
+			return err
+		}
+		//the rest of the page, if the decoder hasn't read it, completes the progress before the sink works
+		if err = page.drain(ctx); err != nil {
+			return err
+		}
+		err = sink.WritePage(ctx, &Page{Index: page.Index, Image: img, Format: page.Format, Resolution: dpi})
+		if err != nil {
+			session.Cancel()
+			return err
+		}
+	}
+}
+
+//prepare applies the profile, the paper size and the options of the request
+func (s *PaperSource) prepare(req *Request) error {
+	if req.Profile != nil {
+		report, err := s.ApplyProfile(req.Profile)
+		if err != nil {
+			return err
+		}
+		for name, err := range report.Failed {
+			log.WithError(err).WithField("option", name).Warn("cannot apply profile option")
+		}
+	}
+	if req.Paper != "" {
+		if err := s.SetPaperSize(req.Paper, req.Orientation); err != nil {
+			return err
+		}
+	}
+
+	//options which change the others go first, like in profiles
+	names := make([]string, 0, len(req.Options))
+	for name := range req.Options {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := profileRank(names[i]), profileRank(names[j])
+		return ri < rj || (ri == rj && names[i] < names[j])
+	})
+	for _, name := range names {
+		var res *SetResult
+		var err error
+		if req.Nearest {
+			res, err = s.SetOptionNearest(name, req.Options[name])
+		} else {
+			res, err = s.SetOption(name, req.Options[name])
+		}
+		if err != nil {
+			return err
+		}
+		if res.Snapped {
+			log.WithField("option", name).WithField("value", res.Value).Warn("option value is snapped to the nearest legal one")
+		} else if res.Inexact {
+			log.WithField("option", name).WithField("value", res.Value).Warn("option value is adjusted by the driver")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lisgo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+//countingSink is MemorySink counting calls of Close and failing WritePage after fail pages if fail > 0
+type countingSink struct {
+	MemorySink
+	fail   int
+	closed int
+}
+
+var errSinkFull = errors.New("sink is full")
+
+func (s *countingSink) WritePage(ctx context.Context, page *Page) error {
+	if s.fail > 0 && len(s.Images) == s.fail {
+		return errSinkFull
+	}
+	return s.MemorySink.WritePage(ctx, page)
+}
+
+func (s *countingSink) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    Request
+		fail   int
+		images int
+		err    bool
+	}{
+		{"flatbed", Request{Device: testDeviceID, Source: "flatbed"}, 0, 1, false},
+		{"feeder", Request{Device: testDeviceID, Source: "feeder"}, 0, 3, false},
+		{"paper", Request{Device: testDeviceID, Source: "feeder", Paper: "A6", Options: map[string]string{OptionResolution: "75"}}, 0, 3, false},
+		{"nearest", Request{Device: testDeviceID, Source: "feeder", Options: map[string]string{OptionResolution: "70"}, Nearest: true}, 0, 3, false},
+		{"strict", Request{Device: testDeviceID, Source: "feeder", Options: map[string]string{OptionResolution: "70"}}, 0, 0, true},
+		{"sink fails", Request{Device: testDeviceID, Source: "feeder"}, 2, 2, true},
+		{"unknown source", Request{Device: testDeviceID, Source: "tray"}, 0, 0, true},
+		{"unknown device", Request{Device: "fake:lisgo:Nothing", Source: "feeder"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := countingSink{fail: tt.fail}
+			err := Scan(context.Background(), tt.req, &sink)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if tt.fail > 0 && err != errSinkFull {
+				t.Errorf("got %v, want the error of the sink", err)
+			}
+			if len(sink.Images) != tt.images {
+				t.Errorf("got %d images, want %d", len(sink.Images), tt.images)
+			}
+			if sink.closed != 1 {
+				t.Errorf("sink is closed %d times", sink.closed)
+			}
+		})
+	}
+}
+
+func TestScanMemorySink(t *testing.T) {
+	var sink MemorySink
+	req := Request{
+		Device:  testDeviceID,
+		Source:  "feeder",
+		Options: map[string]string{OptionResolution: "75", OptionMode: FakeModeGray, OptionBRX: "50", OptionBRY: "30"},
+	}
+	if err := Scan(context.Background(), req, &sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.Images) != 3 {
+		t.Fatalf("got %d images, want 3", len(sink.Images))
+	}
+	width, height := mmToPixels(50, 75), mmToPixels(30, 75)
+	for k, img := range sink.Images {
+		if b := img.Bounds(); b.Dx() != width || b.Dy() != height {
+			t.Fatalf("page %d is %v, want %dx%d", k, b, width, height)
+		}
+		if got, want := img.At(width/2, 0), fakePixel(FakeModeGray, k, width/2, 0, width, height, 75); !sameColor(got, want) {
+			t.Errorf("page %d: got %v, want %v", k, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package lisgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/oliverpool/gofpdf"
+)
+
+//JpegQuality is used for JPEG files and PDF pages
+const JpegQuality = 50
+
+type (
+	//FileSink writes every page to its own image file
+	FileSink struct {
+		//Pattern is the file name with %d for the page number starting from 1, e.g. page%d.png
+		Pattern string
+		//Format is png or jpg
+		Format string
+	}
+
+	//PdfSink writes all pages to a PDF file. Every PDF page has the size of the scanned page if the resolution
+	//is known, A4 otherwise. The file is written by Close, there is no file if there are no pages.
+	PdfSink struct {
+		Name string
+		pdf  *gofpdf.Fpdf
+	}
+
+	//MemorySink keeps the pages in memory
+	MemorySink struct {
+		Images []image.Image
+	}
+)
+
+var (
+	_ PageSink = (*FileSink)(nil)
+	_ PageSink = (*PdfSink)(nil)
+	_ PageSink = (*MemorySink)(nil)
+)
+
+//NewFileSink creates the sink writing files named by pattern in format (png or jpg)
+func NewFileSink(pattern string, format string) *FileSink {
+	return &FileSink{Pattern: pattern, Format: format}
+}
+
+//WritePage writes the page to a file
+func (s *FileSink) WritePage(ctx context.Context, page *Page) error {
+	f, err := os.Create(fmt.Sprintf(s.Pattern, page.Index+1))
+	if err != nil {
+		return err
+	}
+	if err = encodeImage(f, page.Image, s.Format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//Close does nothing, every file is closed by WritePage
+func (s *FileSink) Close() error {
+	return nil
+}
+
+//NewPdfSink creates the sink writing the PDF file with specified name
+func NewPdfSink(name string) *PdfSink {
+	return &PdfSink{Name: name}
+}
+
+//WritePage adds the page to the PDF as JPEG
+func (s *PdfSink) WritePage(ctx context.Context, page *Page) error {
+	b := page.Image.Bounds()
+	pageSize := gofpdf.SizeType{Wd: 210, Ht: 297}
+	if page.Resolution > 0 && b.Dx() > 0 && b.Dy() > 0 {
+		pageSize = gofpdf.SizeType{Wd: float64(b.Dx()) * mmPerInch / float64(page.Resolution), Ht: float64(b.Dy()) * mmPerInch / float64(page.Resolution)}
+	}
+	if s.pdf == nil {
+		s.pdf = gofpdf.New("P", "mm", "A4", "")
+	}
+	s.pdf.AddPageFormat("P", pageSize)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, page.Image, &jpeg.Options{Quality: JpegQuality}); err != nil {
+		return err
+	}
+	opt := gofpdf.ImageOptions{ImageType: "jpeg"}
+	imgName := fmt.Sprintf("page%d.jpg", page.Index+1)
+	s.pdf.RegisterImageOptionsReader(imgName, opt, &buf)
+	s.pdf.ImageOptions(imgName, 0, 0, pageSize.Wd, pageSize.Ht, false, opt, 0, "")
+	return s.pdf.Error()
+}
+
+//Close writes the PDF file if there are pages
+func (s *PdfSink) Close() error {
+	if s.pdf == nil || s.pdf.PageCount() == 0 {
+		return nil
+	}
+	err := s.pdf.OutputFileAndClose(s.Name)
+	s.pdf = nil
+	return err
+}
+
+//WritePage appends the image
+func (s *MemorySink) WritePage(ctx context.Context, page *Page) error {
+	s.Images = append(s.Images, page.Image)
+	return nil
+}
+
+//Close does nothing
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+//encodeImage writes img in format: png or jpg
+func encodeImage(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case "png":
+		return png.Encode(w, img)
+	case "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: JpegQuality})
+	}
+	return errors.New("unknown file format")
+}
@@ -0,0 +1,61 @@
+package lisgo
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPdfSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lisgo-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name   string
+		source string
+		sink   func(name string) *PdfSink
+	}{
+		{"new", "feeder", NewPdfSink},
+		{"literal", "feeder", func(name string) *PdfSink { return &PdfSink{Name: name} }},
+		{"single page", "flatbed", func(name string) *PdfSink { return &PdfSink{Name: name} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(dir, tt.name+".pdf")
+			req := Request{Device: testDeviceID, Source: tt.source, Options: map[string]string{OptionResolution: "75"}}
+			if err := Scan(context.Background(), req, tt.sink(name)); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, []byte("%PDF-")) {
+				t.Errorf("%s is not a PDF", name)
+			}
+		})
+	}
+}
+
+func TestPdfSinkNoPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lisgo-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, sink := range []*PdfSink{NewPdfSink(filepath.Join(dir, "new.pdf")), {Name: filepath.Join(dir, "literal.pdf")}} {
+		if err = sink.Close(); err != nil {
+			t.Errorf("%s: %v", sink.Name, err)
+		}
+		if _, err = os.Stat(sink.Name); !os.IsNotExist(err) {
+			t.Errorf("%s: got %v, want no file", sink.Name, err)
+		}
+	}
+}
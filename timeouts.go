@@ -0,0 +1,124 @@
+package lisgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+)
+
+//Timeouts limit how long lisgo waits for the driver. Zero value means no limit.
+type Timeouts struct {
+	//ListDevices limits device enumeration (ListDevices, GetDevice)
+	ListDevices time.Duration
+	//Open limits opening of a device (Scanner.Open, Scanner.IterateSources)
+	Open time.Duration
+	//ScanStart limits PaperSource.ScanStart
+	ScanStart time.Duration
+	//Read limits every single ScanSession.ScanRead
+	Read time.Duration
+	//WarmUp limits how long ScanRead waits for the lamp to warm up
+	WarmUp time.Duration
+	//Watchdog reports a libinsane call running longer than this value
+	Watchdog time.Duration
+	//OnStall is called by the watchdog with the name of the stalled C proxy. The stall is logged if it's nil.
+	OnStall func(proxy string, elapsed time.Duration)
+}
+
+//ErrTimeout matches every *TimeoutError with errors.Is
+var ErrTimeout = errors.New("timeout")
+
+//TimeoutError is returned when the driver doesn't answer in time
+type TimeoutError struct {
+	//Op is the lisgo operation which has timed out
+	Op string
+	//Func is the libinsane proxy function which was running when the time was up, if known
+	Func string
+	//Limit is the exceeded timeout
+	Limit time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Func == "" {
+		return fmt.Sprintf("%s has timed out after %v", e.Op, e.Limit)
+	}
+	return fmt.Sprintf("%s has timed out after %v in '%s'", e.Op, e.Limit, e.Func)
+}
+
+//Is makes errors.Is(err, ErrTimeout) work
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+//Timeout indicates that this is a timeout error, like net.Error does
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+//SetTimeouts sets limits for the subsequent calls and (re)starts the watchdog. It's safe to call it
+//while other goroutines use the API, calls in progress keep their limits.
+func (o *lisgo) SetTimeouts(t Timeouts) {
+	if t.Watchdog > 0 && t.OnStall == nil {
+		t.OnStall = logStall
+	}
+	o.timeoutsMu.Lock()
+	o.timeouts = t
+	o.timeoutsMu.Unlock()
+	o.backend.setTimeouts(t)
+}
+
+func (o *lisgo) getTimeouts() Timeouts {
+	o.timeoutsMu.Lock()
+	defer o.timeoutsMu.Unlock()
+	return o.timeouts
+}
+
+func logStall(proxy string, elapsed time.Duration) {
+	log.WithFields(log.Fields{
+		"proxy":   proxy,
+		"elapsed": elapsed,
+	}).Warn("libinsane call is stalled")
+}
+
+//newTimeoutError fills in the C proxy the backend is stuck in
+func (o *lisgo) newTimeoutError(op string, limit time.Duration) *TimeoutError {
+	fn, _ := o.backend.currentCall()
+	return &TimeoutError{Op: op, Func: fn, Limit: limit}
+}
+
+//call runs f and waits for it at most limit, no limit if it's zero. On timeout f is abandoned and
+//*TimeoutError is returned, f keeps running in background and done is closed when it returns.
+func (o *lisgo) call(op string, limit time.Duration, f func()) (<-chan struct{}, error) {
+	if limit <= 0 {
+		f()
+		return nil, nil
+	}
+	done := runAsync(f)
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return done, nil
+	case <-timer.C:
+		return done, o.newTimeoutError(op, limit)
+	}
+}
+
+//withTimeout derives a context for the operation limited by limit
+func withTimeout(ctx context.Context, limit time.Duration) (context.Context, context.CancelFunc) {
+	if limit <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, limit)
+}
+
+//checkTimeout converts the deadline of the context made by withTimeout into *TimeoutError,
+//errors caused by the parent context are returned as is
+func (o *lisgo) checkTimeout(parent context.Context, err error, op string, limit time.Duration) error {
+	if err == context.DeadlineExceeded && limit > 0 && parent.Err() == nil {
+		return o.newTimeoutError(op, limit)
+	}
+	return err
+}
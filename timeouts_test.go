@@ -0,0 +1,51 @@
+package lisgo
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestSetTimeoutsWhileScanning(t *testing.T) {
+	ps, release := testSource(t, "feeder")
+	defer release()
+	setTestArea(t, ps, FakeModeGray)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for k := 1; ; k++ {
+			select {
+			case <-stop:
+				return
+			default:
+				ps.lis.SetTimeouts(Timeouts{Read: time.Duration(k) * time.Second, WarmUp: time.Second})
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	session, err := ps.ScanStartContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	for {
+		page, err := session.NextPage(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.Copy(ioutil.Discard, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
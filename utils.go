@@ -23,3 +23,13 @@ func padx(n uint32, x uint32) uint32 {
 	}
 	return x - a + n
 }
+
+//runAsync runs f in a new goroutine, the returned channel is closed when f returns
+func runAsync(f func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	return done
+}
@@ -0,0 +1,176 @@
+package lisgo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+//Canonical names of options which drivers call differently. Mode (OptionMode) is canonical too.
+const (
+	OptionDuplex   = "duplex"
+	OptionPageSize = "page_size"
+)
+
+//ColorModeBW is the canonical black and white mode, libinsane calls it ColorModeLineArt
+const ColorModeBW ColorMode = "BW"
+
+//Canonical values of a string duplex option, the same a boolean one accepts
+const (
+	DuplexOn  = "true"
+	DuplexOff = "false"
+)
+
+//vocabulary maps driver names and values of an option to the canonical ones.
+//Names and values are compared folded, see foldName.
+type vocabulary struct {
+	names  map[string]bool
+	values map[string]string
+}
+
+var vocabularies = map[string]*vocabulary{
+	OptionMode: newVocabulary(
+		[]string{"mode", "scan_mode", "color_mode", "pixel_type", "image_type"},
+		map[string][]string{
+			string(ColorModeBW):    {"BW", "B&W", "LineArt", "Line Art", "Black & White", "Black and White", "Monochrome", "Mono", "Binary", "1bit"},
+			string(ColorModeGray):  {"Gray", "Grey", "Grayscale", "Greyscale", "8bit Gray", "8bit Grayscale", "True Gray"},
+			string(ColorModeColor): {"Color", "Colour", "RGB", "24bit Color", "24bit Colour", "True Color", "48bit Color"},
+		}),
+	OptionDuplex: newVocabulary(
+		[]string{"duplex", "duplex_enabled", "duplex_scan", "adf_duplex", "duplex_mode"},
+		map[string][]string{
+			DuplexOn:  {"true", "On", "Yes", "Duplex", "Double", "Double Sided", "Two Sided", "2-sided", "Both", "Both Sides"},
+			DuplexOff: {"false", "Off", "No", "Simplex", "Single", "Single Sided", "One Sided", "1-sided", "Front", "Front Only"},
+		}),
+	OptionPageSize: newVocabulary(
+		[]string{"page_size", "paper_size", "supported_sizes", "document_size"},
+		pageSizeAliases()),
+}
+
+func newVocabulary(names []string, values map[string][]string) *vocabulary {
+	v := vocabulary{names: make(map[string]bool), values: make(map[string]string)}
+	for _, n := range names {
+		v.names[foldName(n)] = true
+	}
+	for canonical, aliases := range values {
+		for _, a := range aliases {
+			v.values[foldName(a)] = canonical
+		}
+	}
+	return &v
+}
+
+//pageSizeAliases are the paper size names, with ISO and US prefixes drivers use
+func pageSizeAliases() map[string][]string {
+	res := make(map[string][]string)
+	for _, p := range paperSizes {
+		res[p.Name] = []string{p.Name, "ISO " + p.Name, "DIN " + p.Name, "US " + p.Name}
+	}
+	res["ID-1"] = append(res["ID-1"], "ID Card", "Credit Card")
+	return res
+}
+
+//foldName lowercases s and drops everything but letters and digits, so "Black & White" matches "black_white"
+func foldName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+//CanonicalOptionName returns the canonical name of a driver option, or the name itself if it's not in the vocabulary
+func CanonicalOptionName(name string) string {
+	folded := foldName(name)
+	for canonical, v := range vocabularies {
+		if v.names[folded] {
+			return canonical
+		}
+	}
+	return name
+}
+
+//canonicalValue maps a driver value of the option to the canonical one, unknown values are kept
+func canonicalValue(canonical string, val string) string {
+	if v, ok := vocabularies[canonical]; ok {
+		if c, ok := v.values[foldName(val)]; ok {
+			return c
+		}
+	}
+	return val
+}
+
+//CanonicalName returns the name of the option in the canonical vocabulary, e.g. "duplex" for "duplex_enabled"
+func (o *OptionDescriptor) CanonicalName() string {
+	return CanonicalOptionName(o.Name)
+}
+
+//CanonicalValue maps a string value of the option to the canonical one, e.g. Color for "24bit Color".
+//Other values are returned as is.
+func (o *OptionDescriptor) CanonicalValue(v LisValue) LisValue {
+	if v.ValType == LisTypeString {
+		v.StringValue = canonicalValue(o.CanonicalName(), v.StringValue)
+	}
+	return v
+}
+
+//driverValue is the reverse of CanonicalValue: it finds the value of the option's list with the same canonical value.
+//For a bool option, the canonical value (e.g. DuplexOn for "On") is the driver value.
+func (o *OptionDescriptor) driverValue(val string) string {
+	if o.ValueType == LisTypeBool {
+		return canonicalValue(o.CanonicalName(), val)
+	}
+	if o.ValueType != LisTypeString || o.Constraint == nil || o.Constraint.ConstraintType != LisConstraintList {
+		return val
+	}
+	canonical := o.CanonicalName()
+	want := canonicalValue(canonical, val)
+	for _, p := range o.Constraint.PossibleList {
+		if p.ValType == LisTypeString && strings.EqualFold(canonicalValue(canonical, p.StringValue), want) {
+			return p.StringValue
+		}
+	}
+	return val
+}
+
+//CanonicalOption finds the option by its driver name or by the canonical name. It returns nil if there is no such option.
+func (s *PaperSource) CanonicalOption(name string) (*OptionDescriptor, error) {
+	opt, err := s.Option(name)
+	if err != nil || opt != nil {
+		return opt, err
+	}
+	canonical := CanonicalOptionName(name)
+	opts, err := s.options()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		if o.CanonicalName() == canonical {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+//SetCanonical is SetOption accepting canonical names and values: SetCanonical("mode", "BW") sets the option
+//"scan_mode" to "Black & White" if that's how the driver calls it
+func (s *PaperSource) SetCanonical(name string, val string) (*SetResult, error) {
+	opt, err := s.CanonicalOption(name)
+	if err != nil {
+		return nil, err
+	}
+	if opt == nil {
+		return nil, newError(LisErrInvalidValue, "SetCanonical", fmt.Sprintf("option '%s' not found", name))
+	}
+	return s.setCanonical(opt, val)
+}
+
+func (s *PaperSource) setCanonical(opt *OptionDescriptor, val string) (*SetResult, error) {
+	v, err := parseValue(opt.ValueType, opt.driverValue(val))
+	if err != nil {
+		return nil, err
+	}
+	return s.setValue(opt, *v)
+}
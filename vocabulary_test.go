@@ -0,0 +1,200 @@
+package lisgo
+
+import (
+	"testing"
+)
+
+func TestCanonicalValue(t *testing.T) {
+	tests := []struct {
+		option string
+		value  string
+		want   string
+	}{
+		{"mode", "LineArt", string(ColorModeBW)},
+		{"mode", "Line Art", string(ColorModeBW)},
+		{"scan_mode", "Black & White", string(ColorModeBW)},
+		{"color_mode", "B&W", string(ColorModeBW)},
+		{"pixel_type", "BW", string(ColorModeBW)},
+		{"mode", "Grayscale", string(ColorModeGray)},
+		{"mode", "Greyscale", string(ColorModeGray)},
+		{"image_type", "24bit Color", string(ColorModeColor)},
+		{"mode", "RGB", string(ColorModeColor)},
+		{"mode", "Halftone", "Halftone"},
+		{"duplex", "Duplex", DuplexOn},
+		{"duplex_mode", "Both Sides", DuplexOn},
+		{"duplex_mode", "2-sided", DuplexOn},
+		{"duplex_enabled", "Simplex", DuplexOff},
+		{"duplex_mode", "Front Only", DuplexOff},
+		{"adf_duplex", "Off", DuplexOff},
+		{"page_size", "ISO A4", "A4"},
+		{"paper_size", "US Letter", "Letter"},
+		{"document_size", "Credit Card", "ID-1"},
+		{"brightness", "Gray", "Gray"},
+	}
+	for _, tt := range tests {
+		o := OptionDescriptor{Name: tt.option, ValueType: LisTypeString}
+		if got := o.CanonicalValue(LisValue{ValType: LisTypeString, StringValue: tt.value}); got.StringValue != tt.want {
+			t.Errorf("%s=%s: got %s, want %s", tt.option, tt.value, got.StringValue, tt.want)
+		}
+	}
+}
+
+func TestCanonicalOptionName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"scan_mode", OptionMode},
+		{"Color Mode", OptionMode},
+		{"duplex_enabled", OptionDuplex},
+		{"ADF-Duplex", OptionDuplex},
+		{"paper_size", OptionPageSize},
+		{"brightness", "brightness"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalOptionName(tt.name); got != tt.want {
+			t.Errorf("CanonicalOptionName(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+//testVocabularyConfig is a virtual scanner which calls the mode and duplex options its own way
+func testVocabularyConfig() *FakeConfig {
+	stringList := func(values ...string) *OptionConstraint {
+		c := OptionConstraint{ConstraintType: LisConstraintList}
+		for _, v := range values {
+			c.PossibleList = append(c.PossibleList, &LisValue{ValType: LisTypeString, StringValue: v})
+		}
+		return &c
+	}
+	cfg := DefaultFakeConfig()
+	var opts []*FakeOption
+	for _, o := range DefaultFakeOptions() {
+		if o.Name != OptionMode {
+			opts = append(opts, o)
+		}
+	}
+	cfg.Devices[0].Sources[0].Options = append(opts,
+		&FakeOption{
+			Name: "scan_mode", Title: "Scan mode", Capabilities: LisCapSwSelect, ValueType: LisTypeString,
+			Constraint: stringList("Black & White", "Grayscale", "24bit Color"),
+			Value:      &LisValue{ValType: LisTypeString, StringValue: "24bit Color"},
+		},
+		&FakeOption{
+			Name: "duplex_mode", Title: "Duplex", Capabilities: LisCapSwSelect, ValueType: LisTypeString,
+			Constraint: stringList("Simplex", "Duplex"),
+			Value:      &LisValue{ValType: LisTypeString, StringValue: "Simplex"},
+		},
+	)
+	return cfg
+}
+
+func TestSetMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *FakeConfig
+		option string
+		mode   ColorMode
+		driver string
+		want   ColorMode
+	}{
+		{"libinsane bw", nil, OptionMode, ColorModeBW, FakeModeLineArt, ColorModeBW},
+		{"libinsane lineart", nil, OptionMode, ColorModeLineArt, FakeModeLineArt, ColorModeBW},
+		{"libinsane gray", nil, OptionMode, ColorModeGray, FakeModeGray, ColorModeGray},
+		{"libinsane color", nil, OptionMode, ColorModeColor, FakeModeColor, ColorModeColor},
+		{"driver bw", testVocabularyConfig(), "scan_mode", ColorModeBW, "Black & White", ColorModeBW},
+		{"driver lineart", testVocabularyConfig(), "scan_mode", ColorModeLineArt, "Black & White", ColorModeBW},
+		{"driver gray", testVocabularyConfig(), "scan_mode", ColorModeGray, "Grayscale", ColorModeGray},
+		{"driver color", testVocabularyConfig(), "scan_mode", ColorModeColor, "24bit Color", ColorModeColor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps, release := testSourceWith(t, tt.cfg, "flatbed")
+			defer release()
+			if err := ps.SetMode(tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if got := optionString(t, ps, tt.option); got != tt.driver {
+				t.Errorf("%s is %s, want %s", tt.option, got, tt.driver)
+			}
+			mode, err := ps.Mode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode != tt.want {
+				t.Errorf("Mode() is %s, want %s", mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCanonicalDuplex(t *testing.T) {
+	ps, release := testSourceWith(t, testVocabularyConfig(), "flatbed")
+	defer release()
+
+	tests := []struct {
+		value  string
+		driver string
+	}{
+		{DuplexOn, "Duplex"},
+		{DuplexOff, "Simplex"},
+		{"both sides", "Duplex"},
+	}
+	for _, tt := range tests {
+		if _, err := ps.SetCanonical(OptionDuplex, tt.value); err != nil {
+			t.Fatalf("SetCanonical(%s, %s): %v", OptionDuplex, tt.value, err)
+		}
+		if got := optionString(t, ps, "duplex_mode"); got != tt.driver {
+			t.Errorf("%s: duplex_mode is %s, want %s", tt.value, got, tt.driver)
+		}
+	}
+
+	p, err := ps.ExportOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{OptionMode: string(ColorModeColor), OptionDuplex: DuplexOn}
+	for _, po := range p.Options {
+		if v, ok := want[po.Name]; ok && po.Value != v {
+			t.Errorf("exported %s=%s, want %s", po.Name, po.Value, v)
+		}
+		delete(want, po.Name)
+	}
+	if len(want) != 0 {
+		t.Errorf("not exported: %v", want)
+	}
+}
+
+//TestSetCanonicalBoolDuplex is a feeder with a bool duplex option
+func TestSetCanonicalBoolDuplex(t *testing.T) {
+	cfg := DefaultFakeConfig()
+	cfg.Devices[0].Sources[1].Options = append(DefaultFakeOptions(), &FakeOption{
+		Name: "duplex_enabled", Title: "Duplex", Capabilities: LisCapSwSelect, ValueType: LisTypeBool,
+		Value: &LisValue{ValType: LisTypeBool},
+	})
+	ps, release := testSourceWith(t, cfg, "feeder")
+	defer release()
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"On", "true"},
+		{"off", "false"},
+		{"Duplex", "true"},
+		{"Simplex", "false"},
+		{DuplexOn, "true"},
+		{DuplexOff, "false"},
+	}
+	for _, tt := range tests {
+		if _, err := ps.SetCanonical(OptionDuplex, tt.value); err != nil {
+			t.Fatalf("SetCanonical(%s, %s): %v", OptionDuplex, tt.value, err)
+		}
+		if got := optionString(t, ps, "duplex_enabled"); got != tt.want {
+			t.Errorf("%s: duplex_enabled is %s, want %s", tt.value, got, tt.want)
+		}
+	}
+	if _, err := ps.SetCanonical(OptionDuplex, "Sometimes"); err == nil {
+		t.Error("SetCanonical(Sometimes) succeeded")
+	}
+}
@@ -0,0 +1,129 @@
+package lisgo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+)
+
+//DeviceEventType tells what has happened to the device
+type DeviceEventType int
+
+const (
+	//DeviceAdded is sent when the device appears in the list of devices
+	DeviceAdded DeviceEventType = iota
+	//DeviceRemoved is sent when the device disappears from the list of devices
+	DeviceRemoved
+)
+
+func (t DeviceEventType) String() string {
+	switch t {
+	case DeviceAdded:
+		return "Added"
+	case DeviceRemoved:
+		return "Removed"
+	}
+	return fmt.Sprintf("DeviceEventType(%d)", int(t))
+}
+
+//DefaultWatchInterval is used by Watch if the interval isn't positive
+const DefaultWatchInterval = 2 * time.Second
+
+//DeviceEvent is sent by Watch when the set of available scanners changes
+type DeviceEvent struct {
+	Type DeviceEventType
+	//Device is the added scanner or the last known descriptor of the removed one
+	Device *Scanner
+}
+
+func (e DeviceEvent) String() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Device.DeviceID)
+}
+
+//Watch enumerates devices (bypassing the cache) every interval and reports added and removed scanners
+//(by DeviceID) until ctx is done, then the channel is closed. The devices found by the first successful poll are
+//reported as added. A failed poll is logged and skipped, so a transient enumeration error doesn't
+//look like all the scanners have been unplugged. DefaultWatchInterval is used if interval is 0 or negative.
+func (o *lisgo) Watch(ctx context.Context, interval time.Duration) <-chan DeviceEvent {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	events := make(chan DeviceEvent)
+	go o.watch(ctx, interval, events)
+	return events
+}
+
+func (o *lisgo) watch(ctx context.Context, interval time.Duration, events chan<- DeviceEvent) {
+	defer close(events)
+	known := make(map[string]*Scanner)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		devices, err := o.pollDevices(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.WithError(err).Warn("cannot list devices, will retry")
+		} else if !diffDevices(ctx, known, devices, events) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//pollDevices lists devices, it doesn't wait for the enumeration to finish if ctx is done
+func (o *lisgo) pollDevices(ctx context.Context) ([]*Scanner, error) {
+	var devices []*Scanner
+	var err error
+	done := runAsync(func() {
+		devices, err = o.ListDevicesWith(ListOptions{Refresh: true})
+	})
+	select {
+	case <-done:
+		return devices, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+//diffDevices sends events for the difference between known and devices and updates known.
+//It returns false if ctx is done.
+func diffDevices(ctx context.Context, known map[string]*Scanner, devices []*Scanner, events chan<- DeviceEvent) bool {
+	send := func(e DeviceEvent) bool {
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	current := make(map[string]*Scanner, len(devices))
+	for _, d := range devices {
+		current[d.DeviceID] = d
+	}
+	for id, d := range known {
+		if _, ok := current[id]; !ok {
+			delete(known, id)
+			if !send(DeviceEvent{Type: DeviceRemoved, Device: d}) {
+				return false
+			}
+		}
+	}
+	for _, d := range devices {
+		if _, ok := known[d.DeviceID]; !ok {
+			known[d.DeviceID] = d
+			if !send(DeviceEvent{Type: DeviceAdded, Device: d}) {
+				return false
+			}
+		}
+	}
+	return true
+}
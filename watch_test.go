@@ -0,0 +1,29 @@
+package lisgo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchDefaultInterval(t *testing.T) {
+	lis, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events := lis.Watch(ctx, 0)
+	ev, ok := <-events
+	if !ok {
+		t.Fatal("events are closed before the first poll")
+	}
+	if ev.Type != DeviceAdded || ev.Device.DeviceID != testDeviceID {
+		t.Errorf("got %v, want Added: %s", ev, testDeviceID)
+	}
+	cancel()
+	for range events {
+	}
+}
@@ -0,0 +1,266 @@
+package lisgo
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+//Names of the options libinsane normalizes across drivers
+const (
+	OptionResolution = "resolution"
+	OptionMode       = "mode"
+	OptionSource     = "source"
+	OptionTLX        = "tl-x"
+	OptionTLY        = "tl-y"
+	OptionBRX        = "br-x"
+	OptionBRY        = "br-y"
+	//OptionUnits is the unit of the scan area used by some Twain drivers: inches, centimeters or pixels
+	OptionUnits = "units"
+)
+
+//ColorMode is a value of the "mode" option
+type ColorMode string
+
+//Color modes libinsane normalizes the "mode" option to
+const (
+	ColorModeLineArt ColorMode = "LineArt"
+	ColorModeGray    ColorMode = "Gray"
+	ColorModeColor   ColorMode = "Color"
+)
+
+//LengthUnit is a unit of the scan area geometry
+type LengthUnit int
+
+//Units of ScanArea and SetScanArea. Pixels are converted using the current resolution.
+const (
+	LengthMM LengthUnit = iota
+	LengthInch
+	LengthPixel
+	LengthCM
+)
+
+const mmPerInch = 25.4
+
+var lengthUnitNames = map[LengthUnit]string{
+	LengthMM:    "mm",
+	LengthInch:  "in",
+	LengthPixel: "px",
+	LengthCM:    "cm",
+}
+
+func (u LengthUnit) String() string {
+	if name, ok := lengthUnitNames[u]; ok {
+		return name
+	}
+	return fmt.Sprintf("LengthUnit(%d)", int(u))
+}
+
+//Rect is the scan area: coordinates of the top-left and the bottom-right corners
+type Rect struct {
+	Left, Top, Right, Bottom float64
+}
+
+//Width of the rectangle
+func (r Rect) Width() float64 {
+	return r.Right - r.Left
+}
+
+//Height of the rectangle
+func (r Rect) Height() float64 {
+	return r.Bottom - r.Top
+}
+
+//Resolution returns the value of the "resolution" option in DPI
+func (s *PaperSource) Resolution() (int, error) {
+	v, err := s.optionValue(OptionResolution)
+	if err != nil {
+		return 0, err
+	}
+	if v.ValType == LisTypeDouble {
+		return int(math.Round(v.DoubleValue)), nil
+	}
+	return v.IntValue, nil
+}
+
+//SetResolution sets the "resolution" option in DPI
+func (s *PaperSource) SetResolution(dpi int) error {
+	return s.SetInt(OptionResolution, dpi)
+}
+
+//Mode returns the canonical value of the mode option, whatever the driver calls it. Black and white is ColorModeBW.
+func (s *PaperSource) Mode() (ColorMode, error) {
+	opt, err := s.CanonicalOption(OptionMode)
+	if err != nil {
+		return "", err
+	}
+	if opt == nil {
+		return "", newError(LisErrInvalidValue, "Mode", fmt.Sprintf("option '%s' not found", OptionMode))
+	}
+	v, err := opt.GetValue()
+	if err != nil {
+		return "", err
+	}
+	return ColorMode(opt.CanonicalValue(*v).StringValue), nil
+}
+
+//SetMode sets the mode option, the canonical mode is translated to the driver's value
+func (s *PaperSource) SetMode(mode ColorMode) error {
+	_, err := s.SetCanonical(OptionMode, string(mode))
+	return err
+}
+
+//ScanArea returns the scan area (tl-x, tl-y, br-x, br-y options) converted to unit
+func (s *PaperSource) ScanArea(unit LengthUnit) (Rect, error) {
+	var coords [4]float64
+	for k, name := range []string{OptionTLX, OptionTLY, OptionBRX, OptionBRY} {
+		opt, err := s.findOption(name)
+		if err != nil {
+			return Rect{}, err
+		}
+		v, err := opt.GetValue()
+		if err != nil {
+			return Rect{}, err
+		}
+		val := v.DoubleValue
+		if v.ValType == LisTypeInteger {
+			val = float64(v.IntValue)
+		}
+		from, err := s.areaUnit(opt)
+		if err != nil {
+			return Rect{}, err
+		}
+		if coords[k], err = s.convertLength(val, from, unit); err != nil {
+			return Rect{}, err
+		}
+	}
+	return Rect{Left: coords[0], Top: coords[1], Right: coords[2], Bottom: coords[3]}, nil
+}
+
+//SetScanArea converts r from unit to the unit of the area options and sets them.
+//The corners are set in the order which keeps top-left above and to the left of bottom-right.
+func (s *PaperSource) SetScanArea(r Rect, unit LengthUnit) error {
+	if r.Width() <= 0 || r.Height() <= 0 {
+		return newError(LisErrInvalidValue, "SetScanArea", fmt.Sprintf("empty scan area %+v", r))
+	}
+	current, err := s.ScanArea(unit)
+	if err != nil {
+		return err
+	}
+	axes := []struct {
+		tl, br       string
+		tlVal, brVal float64
+		curBR        float64
+	}{
+		{OptionTLX, OptionBRX, r.Left, r.Right, current.Right},
+		{OptionTLY, OptionBRY, r.Top, r.Bottom, current.Bottom},
+	}
+	for _, a := range axes {
+		names := []string{a.tl, a.br}
+		vals := []float64{a.tlVal, a.brVal}
+		if a.tlVal >= a.curBR {
+			//the new top-left is beyond the current bottom-right, move bottom-right first
+			names[0], names[1] = names[1], names[0]
+			vals[0], vals[1] = vals[1], vals[0]
+		}
+		for k, name := range names {
+			if err := s.setLength(name, vals[k], unit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//setLength sets the area option to the value converted from unit
+func (s *PaperSource) setLength(name string, val float64, unit LengthUnit) error {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return err
+	}
+	to, err := s.areaUnit(opt)
+	if err != nil {
+		return err
+	}
+	if val, err = s.convertLength(val, unit, to); err != nil {
+		return err
+	}
+	v := LisValue{ValType: LisTypeDouble, DoubleValue: val}
+	if opt.ValueType == LisTypeInteger {
+		v = LisValue{ValType: LisTypeInteger, IntValue: int(math.Round(val))}
+	}
+	_, err = s.setValue(opt, v)
+	return err
+}
+
+//areaUnit tells the unit of the area option: its ValueUnit, or the "units" option if the unit is not set
+func (s *PaperSource) areaUnit(opt *OptionDescriptor) (LengthUnit, error) {
+	switch opt.ValueUnit {
+	case LisUnitMM:
+		return LengthMM, nil
+	case LisUnitPixel:
+		return LengthPixel, nil
+	}
+	units, err := s.Option(OptionUnits)
+	if err != nil || units == nil || units.ValueType != LisTypeString {
+		//libinsane uses millimeters unless told otherwise
+		return LengthMM, err
+	}
+	v, err := units.GetValue()
+	if err != nil {
+		return LengthMM, err
+	}
+	switch strings.ToLower(v.StringValue) {
+	case "inches":
+		return LengthInch, nil
+	case "centimeters":
+		return LengthCM, nil
+	case "pixels":
+		return LengthPixel, nil
+	}
+	return LengthMM, nil
+}
+
+//convertLength converts val between units, pixels require the resolution
+func (s *PaperSource) convertLength(val float64, from LengthUnit, to LengthUnit) (float64, error) {
+	if from == to {
+		return val, nil
+	}
+	var dpi int
+	if from == LengthPixel || to == LengthPixel {
+		var err error
+		if dpi, err = s.Resolution(); err != nil {
+			return 0, err
+		}
+		if dpi <= 0 {
+			return 0, newError(LisErrInvalidValue, "convertLength", fmt.Sprintf("invalid resolution %d", dpi))
+		}
+	}
+	mm := val
+	switch from {
+	case LengthInch:
+		mm = val * mmPerInch
+	case LengthCM:
+		mm = val * 10
+	case LengthPixel:
+		mm = val * mmPerInch / float64(dpi)
+	}
+	switch to {
+	case LengthInch:
+		return mm / mmPerInch, nil
+	case LengthCM:
+		return mm / 10, nil
+	case LengthPixel:
+		return mm / mmPerInch * float64(dpi), nil
+	}
+	return mm, nil
+}
+
+//optionValue reads the value of the option with specified name
+func (s *PaperSource) optionValue(name string) (*LisValue, error) {
+	opt, err := s.findOption(name)
+	if err != nil {
+		return nil, err
+	}
+	return opt.GetValue()
+}
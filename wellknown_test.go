@@ -0,0 +1,137 @@
+package lisgo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConvertLength(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+	if err := ps.SetResolution(300); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		val      float64
+		from, to LengthUnit
+		want     float64
+	}{
+		{25.4, LengthMM, LengthInch, 1},
+		{2, LengthInch, LengthMM, 50.8},
+		{1, LengthInch, LengthPixel, 300},
+		{300, LengthPixel, LengthInch, 1},
+		{25.4, LengthMM, LengthPixel, 300},
+		{150, LengthPixel, LengthMM, 12.7},
+		{2.54, LengthCM, LengthInch, 1},
+		{15, LengthMM, LengthCM, 1.5},
+		{42, LengthPixel, LengthPixel, 42},
+	}
+	for _, tt := range tests {
+		got, err := ps.convertLength(tt.val, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%v %s is %v %s, want %v", tt.val, tt.from, got, tt.to, tt.want)
+		}
+	}
+}
+
+func TestScanArea(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+	if err := ps.SetResolution(300); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		area Rect
+		unit LengthUnit
+		mm   Rect
+	}{
+		{Rect{Left: 10, Top: 20, Right: 110, Bottom: 170}, LengthMM, Rect{Left: 10, Top: 20, Right: 110, Bottom: 170}},
+		{Rect{Left: 1, Top: 2, Right: 4, Bottom: 6}, LengthInch, Rect{Left: 25.4, Top: 50.8, Right: 101.6, Bottom: 152.4}},
+		{Rect{Left: 300, Top: 600, Right: 1200, Bottom: 1800}, LengthPixel, Rect{Left: 25.4, Top: 50.8, Right: 101.6, Bottom: 152.4}},
+		//the top-left corner is beyond the current bottom-right one, bottom-right goes first
+		{Rect{Left: 180, Top: 200, Right: 215.9, Bottom: 297}, LengthMM, Rect{Left: 180, Top: 200, Right: 215.9, Bottom: 297}},
+		{Rect{Left: 0, Top: 0, Right: 5, Bottom: 5}, LengthCM, Rect{Left: 0, Top: 0, Right: 50, Bottom: 50}},
+	}
+	for _, tt := range tests {
+		if err := ps.SetScanArea(tt.area, tt.unit); err != nil {
+			t.Fatalf("SetScanArea(%+v, %s): %v", tt.area, tt.unit, err)
+		}
+		for _, unit := range []LengthUnit{LengthMM, tt.unit} {
+			want := tt.mm
+			if unit == tt.unit {
+				want = tt.area
+			}
+			got, err := ps.ScanArea(unit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameRect(got, want) {
+				t.Errorf("ScanArea(%s) is %+v, want %+v", unit, got, want)
+			}
+		}
+	}
+}
+
+func TestSetScanAreaErrors(t *testing.T) {
+	ps, release := testSource(t, "flatbed")
+	defer release()
+
+	tests := []struct {
+		name string
+		area Rect
+		unit LengthUnit
+	}{
+		{"empty", Rect{Left: 10, Top: 10, Right: 10, Bottom: 20}, LengthMM},
+		{"upside down", Rect{Left: 10, Top: 20, Right: 20, Bottom: 10}, LengthMM},
+		{"too wide", Rect{Left: 0, Top: 0, Right: 9, Bottom: 5}, LengthInch},
+	}
+	for _, tt := range tests {
+		if err := ps.SetScanArea(tt.area, tt.unit); err == nil {
+			t.Errorf("%s: SetScanArea(%+v, %s) succeeded", tt.name, tt.area, tt.unit)
+		}
+	}
+}
+
+//TestScanAreaUnitsOption is a Twain driver telling the unit of the area by the "units" option
+func TestScanAreaUnitsOption(t *testing.T) {
+	cfg := DefaultFakeConfig()
+	opts := DefaultFakeOptions()
+	for _, o := range opts {
+		if o.ValueUnit == LisUnitMM {
+			o.ValueUnit = LisUnitNone
+			o.Constraint = nil
+			o.Value.DoubleValue /= mmPerInch
+		}
+	}
+	cfg.Devices[0].Sources[0].Options = append(opts, &FakeOption{
+		Name: OptionUnits, Title: "Units", Capabilities: LisCapSwSelect, ValueType: LisTypeString,
+		Value: &LisValue{ValType: LisTypeString, StringValue: "Inches"},
+	})
+	ps, release := testSourceWith(t, cfg, "flatbed")
+	defer release()
+
+	if err := ps.SetScanArea(Rect{Left: 25.4, Top: 0, Right: 127, Bottom: 254}, LengthMM); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ps.ScanArea(LengthInch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Rect{Left: 1, Top: 0, Right: 5, Bottom: 10}); !sameRect(got, want) {
+		t.Errorf("ScanArea(in) is %+v, want %+v", got, want)
+	}
+	if v, err := ps.optionValue(OptionBRX); err != nil || math.Abs(v.DoubleValue-5) > 1e-9 {
+		t.Errorf("br-x is %v, %v, want 5 inches", v, err)
+	}
+}
+
+func sameRect(a, b Rect) bool {
+	const eps = 1e-9
+	return math.Abs(a.Left-b.Left) < eps && math.Abs(a.Top-b.Top) < eps &&
+		math.Abs(a.Right-b.Right) < eps && math.Abs(a.Bottom-b.Bottom) < eps
+}
@@ -0,0 +1,752 @@
+package lisgo
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+//The worker process ("lisgo worker") runs libinsane on behalf of the library, so a crashing driver
+//doesn't take down the whole application. Both sides exchange gob-encoded workerRequest/workerResponse
+//over the worker's stdin/stdout. Requests are served concurrently, responses are matched by ID.
+
+//WorkerEnvVar is the path of the worker executable used when LISGO_BACKEND=worker, "lisgo" by default
+const WorkerEnvVar = "LISGO_WORKER"
+
+//ErrWorkerDied is returned by calls interrupted by the death of the worker process and by objects
+//(devices, sources, sessions) which belong to the dead worker. The next ListDevices/GetDevice restarts it.
+var ErrWorkerDied = errors.New("lisgo worker process has died")
+
+//worker protocol methods
+const (
+	wmListDevices    = "listDevices"
+	wmGetDevice      = "getDevice"
+	wmSetTimeouts    = "setTimeouts"
+	wmCurrentCall    = "currentCall"
+	wmItemChildren   = "itemChildren"
+	wmItemOptions    = "itemOptions"
+	wmItemScanStart  = "itemScanStart"
+	wmItemClose      = "itemClose"
+	wmOptionGetValue = "optionGetValue"
+	wmOptionSetValue = "optionSetValue"
+	wmSessionEOF     = "sessionEndOfFeed"
+	wmSessionEOP     = "sessionEndOfPage"
+	wmSessionParams  = "sessionScanParameters"
+	wmSessionRead    = "sessionScanRead"
+	wmSessionCancel  = "sessionCancel"
+	wmSessionClose   = "sessionClose"
+)
+
+type (
+	workerRequest struct {
+		ID     uint64
+		Method string
+		//Handle identifies an item or a session in the worker
+		Handle uint64
+		//Index is the index of the option in the last options list of the item
+		Index int
+		Name  string
+		//LisValue is the value of optionSetValue
+		LisValue *LisValue
+		//Locations is enum lis_device_locations of listDevices
+		Locations uint32
+		Timeouts  Timeouts
+		//Size is the buffer size of sessionScanRead
+		Size int
+	}
+
+	workerResponse struct {
+		ID      uint64
+		Err     *workerError
+		Handle  uint64
+		Devices []*Scanner
+		Items   []workerItemInfo
+		Options []workerOptionInfo
+		Value   *LisValue
+		Params  workerParams
+		Data    []byte
+		Flag    bool
+		//SetFlags are LIS_SET_FLAG_* of optionSetValue
+		SetFlags int
+		Name     string
+		Elapsed  time.Duration
+	}
+
+	//workerError carries *Error, *TimeoutError or any other error across the pipe
+	workerError struct {
+		Code  uint32
+		Func  string
+		Msg   string
+		Op    string
+		Limit time.Duration
+		Kind  int
+	}
+
+	workerItemInfo struct {
+		Handle uint64
+		Name   string
+		Kind   ItemType
+	}
+
+	workerOptionInfo struct {
+		Name         string
+		Title        string
+		Desc         string
+		Capabilities int
+		ValueType    ValueType
+		ValueUnit    Unit
+		Constraint   *OptionConstraint
+	}
+
+	workerParams struct {
+		Format    ImageFormat
+		Width     int
+		Height    int
+		ImageSize uint
+	}
+)
+
+//workerError kinds
+const (
+	workerErrOther = iota
+	workerErrLis
+	workerErrTimeout
+)
+
+func newWorkerError(err error) *workerError {
+	if err == nil {
+		return nil
+	}
+	switch e := err.(type) {
+	case *Error:
+		return &workerError{Kind: workerErrLis, Code: e.Code, Func: e.Func, Msg: e.Msg}
+	case *TimeoutError:
+		return &workerError{Kind: workerErrTimeout, Op: e.Op, Func: e.Func, Limit: e.Limit}
+	}
+	return &workerError{Kind: workerErrOther, Msg: err.Error()}
+}
+
+func (e *workerError) toError() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Kind {
+	case workerErrLis:
+		return &Error{Code: e.Code, Func: e.Func, Msg: e.Msg}
+	case workerErrTimeout:
+		return &TimeoutError{Op: e.Op, Func: e.Func, Limit: e.Limit}
+	}
+	return errors.New(e.Msg)
+}
+
+type (
+	//workerBackend implements backend by forwarding every call to the worker process
+	workerBackend struct {
+		path     string
+		args     []string
+		mu       sync.Mutex
+		proc     *workerProcess
+		timeouts Timeouts
+	}
+
+	//workerProcess is a running worker, the objects it has returned are valid while it's alive
+	workerProcess struct {
+		cmd     *exec.Cmd
+		stdin   io.WriteCloser
+		encMu   sync.Mutex
+		enc     *gob.Encoder
+		mu      sync.Mutex
+		nextID  uint64
+		pending map[uint64]chan *workerResponse
+		dead    chan struct{}
+		dieOnce sync.Once
+	}
+
+	workerItem struct {
+		p        *workerProcess
+		handle   uint64
+		itemName string
+		itemKind ItemType
+	}
+
+	workerOption struct {
+		p      *workerProcess
+		handle uint64
+		index  int
+	}
+
+	workerSession struct {
+		p      *workerProcess
+		handle uint64
+	}
+)
+
+//NewWorker creates new instance of the scanning API which runs libinsane in a child process.
+//The child is started as "path args...", args default to "worker" which is the lisgo command serving the protocol.
+func NewWorker(path string, args ...string) (*lisgo, error) {
+	if len(args) == 0 {
+		args = []string{"worker"}
+	}
+	b := &workerBackend{path: path, args: args}
+	if _, err := b.process(); err != nil {
+		return nil, err
+	}
+	return &lisgo{backend: b}, nil
+}
+
+//newWorkerFromEnv starts the worker from LISGO_WORKER
+func newWorkerFromEnv() (*lisgo, error) {
+	path := os.Getenv(WorkerEnvVar)
+	if path == "" {
+		path = "lisgo"
+	}
+	return NewWorker(path)
+}
+
+//process returns the running worker, a new one is started if the previous has died
+func (b *workerBackend) process() (*workerProcess, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.proc != nil && !b.proc.isDead() {
+		return b.proc, nil
+	}
+	if b.proc != nil {
+		log.WithField("worker", b.path).Warn("lisgo worker has died, restarting")
+	}
+	p, err := startWorker(b.path, b.args)
+	if err != nil {
+		return nil, err
+	}
+	b.proc = p
+	//a restarted worker gets the limits set before
+	if _, err := p.call(workerRequest{Method: wmSetTimeouts, Timeouts: b.timeouts}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func startWorker(path string, args []string) (*workerProcess, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start lisgo worker: %v", err)
+	}
+	p := workerProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     gob.NewEncoder(stdin),
+		pending: make(map[uint64]chan *workerResponse),
+		dead:    make(chan struct{}),
+	}
+	go p.readLoop(gob.NewDecoder(stdout))
+	return &p, nil
+}
+
+func (p *workerProcess) readLoop(dec *gob.Decoder) {
+	for {
+		var resp workerResponse
+		if err := dec.Decode(&resp); err != nil {
+			if err != io.EOF {
+				log.WithError(err).Error("lisgo worker connection is broken")
+			}
+			p.die()
+			return
+		}
+		p.mu.Lock()
+		ch := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+		if ch != nil {
+			ch <- &resp
+		}
+	}
+}
+
+//die kills the process and fails the pending calls
+func (p *workerProcess) die() {
+	p.dieOnce.Do(func() {
+		close(p.dead)
+		_ = p.stdin.Close()
+		_ = p.cmd.Process.Kill()
+		_ = p.cmd.Wait()
+	})
+}
+
+func (p *workerProcess) isDead() bool {
+	select {
+	case <-p.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+//call sends the request and waits for the response
+func (p *workerProcess) call(req workerRequest) (*workerResponse, error) {
+	ch := make(chan *workerResponse, 1)
+	p.mu.Lock()
+	if p.isDead() {
+		p.mu.Unlock()
+		return nil, ErrWorkerDied
+	}
+	p.nextID++
+	req.ID = p.nextID
+	p.pending[req.ID] = ch
+	p.mu.Unlock()
+
+	p.encMu.Lock()
+	err := p.enc.Encode(&req)
+	p.encMu.Unlock()
+	if err != nil {
+		p.die()
+		return nil, ErrWorkerDied
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, resp.Err.toError()
+	case <-p.dead:
+		return nil, ErrWorkerDied
+	}
+}
+
+func (b *workerBackend) cleanup() {
+	b.mu.Lock()
+	p := b.proc
+	b.proc = nil
+	b.mu.Unlock()
+	if p == nil {
+		return
+	}
+	//the worker releases libinsane and exits when its stdin is closed
+	_ = p.stdin.Close()
+	select {
+	case <-p.dead:
+	case <-time.After(5 * time.Second):
+		p.die()
+	}
+}
+
+func (b *workerBackend) setTimeouts(t Timeouts) {
+	b.mu.Lock()
+	b.timeouts = t
+	p := b.proc
+	b.mu.Unlock()
+	if p != nil {
+		//OnStall can't cross the pipe, the worker logs stalls to its stderr
+		_, _ = p.call(workerRequest{Method: wmSetTimeouts, Timeouts: t})
+	}
+}
+
+func (b *workerBackend) currentCall() (string, time.Duration) {
+	b.mu.Lock()
+	p := b.proc
+	b.mu.Unlock()
+	if p == nil {
+		return "", 0
+	}
+	resp, err := p.call(workerRequest{Method: wmCurrentCall})
+	if err != nil {
+		return "", 0
+	}
+	return resp.Name, resp.Elapsed
+}
+
+func (b *workerBackend) listDevices(locations uint32) ([]*Scanner, error) {
+	p, err := b.process()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.call(workerRequest{Method: wmListDevices, Locations: locations})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Devices, nil
+}
+
+func (b *workerBackend) getDevice(deviceID string) (backendItem, error) {
+	p, err := b.process()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.call(workerRequest{Method: wmGetDevice, Name: deviceID})
+	if err != nil {
+		return nil, err
+	}
+	return &workerItem{p: p, handle: resp.Handle, itemName: deviceID, itemKind: LisItemDevice}, nil
+}
+
+func (i *workerItem) name() string {
+	return i.itemName
+}
+
+func (i *workerItem) kind() ItemType {
+	return i.itemKind
+}
+
+func (i *workerItem) close() {
+	_, _ = i.p.call(workerRequest{Method: wmItemClose, Handle: i.handle})
+}
+
+func (i *workerItem) children() ([]backendItem, error) {
+	resp, err := i.p.call(workerRequest{Method: wmItemChildren, Handle: i.handle})
+	if err != nil {
+		return nil, err
+	}
+	var res []backendItem
+	for _, c := range resp.Items {
+		res = append(res, &workerItem{p: i.p, handle: c.Handle, itemName: c.Name, itemKind: c.Kind})
+	}
+	return res, nil
+}
+
+func (i *workerItem) options() ([]*OptionDescriptor, error) {
+	resp, err := i.p.call(workerRequest{Method: wmItemOptions, Handle: i.handle})
+	if err != nil {
+		return nil, err
+	}
+	var res []*OptionDescriptor
+	for k, o := range resp.Options {
+		res = append(res, &OptionDescriptor{
+			Name:         o.Name,
+			Title:        o.Title,
+			Desc:         o.Desc,
+			Capabilities: o.Capabilities,
+			ValueType:    o.ValueType,
+			ValueUnit:    o.ValueUnit,
+			Constraint:   o.Constraint,
+			opt:          &workerOption{p: i.p, handle: i.handle, index: k},
+		})
+	}
+	return res, nil
+}
+
+func (i *workerItem) scanStart() (backendSession, error) {
+	resp, err := i.p.call(workerRequest{Method: wmItemScanStart, Handle: i.handle})
+	if err != nil {
+		return nil, err
+	}
+	return &workerSession{p: i.p, handle: resp.Handle}, nil
+}
+
+func (o *workerOption) getValue() (*LisValue, error) {
+	resp, err := o.p.call(workerRequest{Method: wmOptionGetValue, Handle: o.handle, Index: o.index})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Value, nil
+}
+
+func (o *workerOption) setValue(v *LisValue) (int, error) {
+	resp, err := o.p.call(workerRequest{Method: wmOptionSetValue, Handle: o.handle, Index: o.index, LisValue: v})
+	if err != nil {
+		return 0, err
+	}
+	return resp.SetFlags, nil
+}
+
+func (s *workerSession) flag(method string) bool {
+	resp, err := s.p.call(workerRequest{Method: method, Handle: s.handle})
+	if err != nil {
+		//nothing more can be read from the dead worker
+		return true
+	}
+	return resp.Flag
+}
+
+func (s *workerSession) endOfFeed() bool {
+	return s.flag(wmSessionEOF)
+}
+
+func (s *workerSession) endOfPage() bool {
+	return s.flag(wmSessionEOP)
+}
+
+func (s *workerSession) scanParameters() (*ScanParameters, error) {
+	resp, err := s.p.call(workerRequest{Method: wmSessionParams, Handle: s.handle})
+	if err != nil {
+		return nil, err
+	}
+	return &ScanParameters{
+		format:    resp.Params.Format,
+		width:     resp.Params.Width,
+		height:    resp.Params.Height,
+		imageSize: resp.Params.ImageSize,
+	}, nil
+}
+
+func (s *workerSession) scanRead(size int) ([]byte, error) {
+	resp, err := s.p.call(workerRequest{Method: wmSessionRead, Handle: s.handle, Size: size})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func (s *workerSession) cancel() {
+	_, _ = s.p.call(workerRequest{Method: wmSessionCancel, Handle: s.handle})
+}
+
+func (s *workerSession) close() {
+	_, _ = s.p.call(workerRequest{Method: wmSessionClose, Handle: s.handle})
+}
+
+//workerServer is the worker side of the protocol
+type workerServer struct {
+	backend backend
+	encMu   sync.Mutex
+	enc     *gob.Encoder
+
+	mu         sync.Mutex
+	nextHandle uint64
+	items      map[uint64]backendItem
+	options    map[uint64][]*OptionDescriptor //the last options list of every item
+	sessions   map[uint64]backendSession
+	//children are the handles of the child items of every item, they're released with the item
+	children map[uint64][]uint64
+}
+
+func newWorkerServer(b backend, w io.Writer) *workerServer {
+	return &workerServer{
+		backend:  b,
+		enc:      gob.NewEncoder(w),
+		items:    make(map[uint64]backendItem),
+		options:  make(map[uint64][]*OptionDescriptor),
+		sessions: make(map[uint64]backendSession),
+		children: make(map[uint64][]uint64),
+	}
+}
+
+//ServeWorker serves the worker protocol on r and w until r is closed. This is what "lisgo worker" runs.
+//It uses LISGO_BACKEND to choose the backend, the default one if it's empty or "worker".
+func ServeWorker(r io.Reader, w io.Writer) error {
+	name := os.Getenv(BackendEnvVar)
+	if name == "" || name == BackendWorker {
+		name = defaultBackend
+	}
+	b, err := newBackend(name)
+	if err != nil {
+		return err
+	}
+	defer b.cleanup()
+
+	srv := newWorkerServer(b, w)
+	dec := gob.NewDecoder(r)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var req workerRequest
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := srv.serve(&req)
+			resp.ID = req.ID
+			srv.encMu.Lock()
+			err := srv.enc.Encode(resp)
+			srv.encMu.Unlock()
+			if err != nil {
+				log.WithError(err).Error("cannot send worker response")
+			}
+		}()
+	}
+}
+
+func (srv *workerServer) addHandle(item backendItem, session backendSession) uint64 {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.nextHandle++
+	if item != nil {
+		srv.items[srv.nextHandle] = item
+	}
+	if session != nil {
+		srv.sessions[srv.nextHandle] = session
+	}
+	return srv.nextHandle
+}
+
+func (srv *workerServer) item(h uint64) (backendItem, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if i, ok := srv.items[h]; ok {
+		return i, nil
+	}
+	return nil, fmt.Errorf("unknown item handle %d", h)
+}
+
+func (srv *workerServer) session(h uint64) (backendSession, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if s, ok := srv.sessions[h]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown session handle %d", h)
+}
+
+func (srv *workerServer) option(h uint64, index int) (*OptionDescriptor, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	opts := srv.options[h]
+	if index < 0 || index >= len(opts) {
+		return nil, fmt.Errorf("unknown option %d of item %d", index, h)
+	}
+	return opts[index], nil
+}
+
+func (srv *workerServer) serve(req *workerRequest) *workerResponse {
+	var resp workerResponse
+	var err error
+	switch req.Method {
+	case wmListDevices:
+		resp.Devices, err = srv.backend.listDevices(req.Locations)
+	case wmGetDevice:
+		var dev backendItem
+		if dev, err = srv.backend.getDevice(req.Name); err == nil {
+			resp.Handle = srv.addHandle(dev, nil)
+		}
+	case wmSetTimeouts:
+		t := req.Timeouts
+		if t.Watchdog > 0 {
+			t.OnStall = logStall
+		}
+		srv.backend.setTimeouts(t)
+	case wmCurrentCall:
+		resp.Name, resp.Elapsed = srv.backend.currentCall()
+	case wmItemChildren, wmItemOptions, wmItemScanStart, wmItemClose:
+		var item backendItem
+		if item, err = srv.item(req.Handle); err == nil {
+			err = srv.serveItem(req, item, &resp)
+		}
+	case wmOptionGetValue, wmOptionSetValue:
+		var opt *OptionDescriptor
+		if opt, err = srv.option(req.Handle, req.Index); err != nil {
+			break
+		}
+		if req.Method == wmOptionGetValue {
+			resp.Value, err = opt.opt.getValue()
+		} else {
+			resp.SetFlags, err = opt.opt.setValue(req.LisValue)
+		}
+	default:
+		var session backendSession
+		if session, err = srv.session(req.Handle); err == nil {
+			err = srv.serveSession(req, session, &resp)
+		}
+	}
+	resp.Err = newWorkerError(err)
+	return &resp
+}
+
+func (srv *workerServer) serveItem(req *workerRequest, item backendItem, resp *workerResponse) error {
+	switch req.Method {
+	case wmItemChildren:
+		children, err := item.children()
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			h := srv.addHandle(c, nil)
+			srv.mu.Lock()
+			srv.children[req.Handle] = append(srv.children[req.Handle], h)
+			srv.mu.Unlock()
+			resp.Items = append(resp.Items, workerItemInfo{Handle: h, Name: c.name(), Kind: c.kind()})
+		}
+	case wmItemOptions:
+		opts, err := item.options()
+		if err != nil {
+			return err
+		}
+		srv.mu.Lock()
+		srv.options[req.Handle] = opts
+		srv.mu.Unlock()
+		for _, o := range opts {
+			resp.Options = append(resp.Options, workerOptionInfo{
+				Name:         o.Name,
+				Title:        o.Title,
+				Desc:         o.Desc,
+				Capabilities: o.Capabilities,
+				ValueType:    o.ValueType,
+				ValueUnit:    o.ValueUnit,
+				Constraint:   o.Constraint,
+			})
+		}
+	case wmItemScanStart:
+		session, err := item.scanStart()
+		if err != nil {
+			return err
+		}
+		resp.Handle = srv.addHandle(nil, session)
+	case wmItemClose:
+		item.close()
+		srv.mu.Lock()
+		srv.release(req.Handle)
+		srv.mu.Unlock()
+	}
+	return nil
+}
+
+//release drops the handle of the item and of its descendants, the client never closes child items.
+//srv.mu must be held.
+func (srv *workerServer) release(h uint64) {
+	for _, c := range srv.children[h] {
+		srv.release(c)
+	}
+	delete(srv.children, h)
+	delete(srv.items, h)
+	delete(srv.options, h)
+}
+
+func (srv *workerServer) serveSession(req *workerRequest, session backendSession, resp *workerResponse) error {
+	var err error
+	switch req.Method {
+	case wmSessionEOF:
+		resp.Flag = session.endOfFeed()
+	case wmSessionEOP:
+		resp.Flag = session.endOfPage()
+	case wmSessionParams:
+		var params *ScanParameters
+		if params, err = session.scanParameters(); err == nil {
+			resp.Params = workerParams{
+				Format:    params.format,
+				Width:     params.width,
+				Height:    params.height,
+				ImageSize: params.imageSize,
+			}
+		}
+	case wmSessionRead:
+		if req.Size <= 0 {
+			req.Size = ScanSessionCBufferSize
+		}
+		resp.Data, err = session.scanRead(req.Size)
+	case wmSessionCancel:
+		session.cancel()
+	case wmSessionClose:
+		session.close()
+		srv.mu.Lock()
+		delete(srv.sessions, req.Handle)
+		srv.mu.Unlock()
+	default:
+		err = fmt.Errorf("unknown worker method '%s'", req.Method)
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package lisgo
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestWorkerServerReleasesChildren(t *testing.T) {
+	srv := newWorkerServer(newFakeBackend(DefaultFakeConfig()), ioutil.Discard)
+	call := func(req workerRequest) *workerResponse {
+		t.Helper()
+		resp := srv.serve(&req)
+		if resp.Err != nil {
+			t.Fatalf("%s: %v", req.Method, resp.Err)
+		}
+		return resp
+	}
+
+	dev := call(workerRequest{Method: wmGetDevice, Name: testDeviceID}).Handle
+	//listing sources twice makes new handles every time
+	for k := 0; k < 2; k++ {
+		for _, s := range call(workerRequest{Method: wmItemChildren, Handle: dev}).Items {
+			call(workerRequest{Method: wmItemOptions, Handle: s.Handle})
+			call(workerRequest{Method: wmItemChildren, Handle: s.Handle})
+		}
+	}
+	if n := len(srv.items); n != 1+2*(2+2) {
+		t.Fatalf("got %d item handles before close", n)
+	}
+
+	call(workerRequest{Method: wmItemClose, Handle: dev})
+	if len(srv.items) != 0 || len(srv.options) != 0 || len(srv.children) != 0 {
+		t.Errorf("handles left after close: %d items, %d options, %d children", len(srv.items), len(srv.options), len(srv.children))
+	}
+}